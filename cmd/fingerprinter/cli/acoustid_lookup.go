@@ -5,18 +5,21 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"time"
 
-	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 
+	hc "github.com/ocramh/fingerprinter/internal/httpclient"
 	ac "github.com/ocramh/fingerprinter/pkg/acoustid"
 	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
 )
 
 var (
-	apikey string
+	apikey           string
+	acoustIDEndpoint string
+	acoustIDTimeout  time.Duration
+	acoustIDAttempts int
+	acoustIDMaxRetry time.Duration
 )
 
 func init() {
@@ -25,31 +28,89 @@ func init() {
 	acoustidCmd.Flags().StringVarP(&inputFile, "audiofile", "a", "", "audio file path")
 	acoustidCmd.MarkFlagRequired("apikey")
 	acoustidCmd.MarkFlagRequired("audiofile")
+	addAcoustIDFlags(acoustidCmd)
+	addScanFlags(acoustidCmd)
+	addProgressFlag(acoustidCmd)
+}
+
+// addAcoustIDFlags adds the flags configuring the AcoustID client
+func addAcoustIDFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&acoustIDEndpoint, "acoustid-url", ac.DefaultEndpoint, "root URL of the AcoustID API")
+	cmd.Flags().DurationVar(&acoustIDTimeout, "acoustid-timeout", hc.ReqTimeout, "timeout of the AcoustID API requests")
+	cmd.Flags().IntVar(&acoustIDAttempts, "acoustid-attempts", ac.DefaultRetryPolicy.MaxAttempts, "maximum number of attempts of a failed AcoustID request, 0 means no limit other than --acoustid-max-retry-time")
+	cmd.Flags().DurationVar(&acoustIDMaxRetry, "acoustid-max-retry-time", ac.DefaultRetryPolicy.MaxElapsedTime, "time after which a failed AcoustID request isn't retried anymore, 0 means no limit other than --acoustid-attempts")
+}
+
+// newAcoustID returns the AcoustID client configured by the AcoustID flags
+func newAcoustID() *ac.AcoustID {
+	retry := ac.DefaultRetryPolicy
+	retry.MaxAttempts = acoustIDAttempts
+	retry.MaxElapsedTime = acoustIDMaxRetry
+
+	opts := []ac.Option{
+		ac.WithEndpoint(acoustIDEndpoint),
+		ac.WithTimeout(acoustIDTimeout),
+		ac.WithRateLimit(acoustIDRate, time.Second),
+		ac.WithRateLimitLockFile(rateLimitLockFile("acoustid")),
+		ac.WithRetryPolicy(retry),
+	}
+	if appName != "" {
+		opts = append(opts, ac.WithUserAgent(appName+"/"+semVer))
+	}
+	if semVer != "" {
+		opts = append(opts, ac.WithClientVersion(semVer))
+	}
+
+	return ac.NewAcoustID(apikey, opts...)
 }
 
 var acoustidCmd = &cobra.Command{
 	Use:   "acoustid",
 	Short: "Generate an audio fingerprint and queries the AcoustID API to find matching recording ID(s)",
 	Run: func(cmd *cobra.Command, args []string) {
-		chroma := fp.NewChromaPrint(exec.Command, afero.NewOsFs())
-		fingerprints, err := chroma.CalcFingerprint(inputFile)
+		ctx, cancel := signalContext()
+		defer cancel()
+
+		progress, stopProgress := newProgress()
+		defer stopProgress()
+
+		chroma, done := newFingerprinter(append(scanOptions(), fp.WithProgress(progress))...)
+		defer done()
+
+		res, err := chroma.CalcFingerprintContext(ctx, inputFile)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		acoustIDClient := ac.NewAcoustID(apikey)
-		retryOnFail := true
+		acoustIDClient := newAcoustID()
 
-		var lookupRes []ac.ACLookupResult
-		for _, fingerprint := range fingerprints {
-			resp, err := acoustIDClient.LookupFingerprint(fingerprint, retryOnFail)
-			if err != nil {
-				log.Fatal(err)
+		lookups, err := acoustIDClient.LookupFingerprintsFunc(ctx, res.Fingerprints, func(batch []ac.BatchLookupResult) {
+			for _, lookup := range batch {
+				if lookup.Err != nil {
+					progress.Failed(lookup.Fingerprint.Path(), lookup.Err)
+				} else {
+					progress.LookedUp(lookup.Fingerprint.Path())
+				}
 			}
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
 
-			lookupRes = append(lookupRes, resp.Results...)
+		var lookupRes []ac.ACLookupResult
+		var lookupErrs []*ac.BatchLookupResult
+		for i, lookup := range lookups {
+			if lookup.Err != nil {
+				lookupErrs = append(lookupErrs, &lookups[i])
+				continue
+			}
+			lookupRes = append(lookupRes, lookup.Results...)
+		}
 
-			time.Sleep(ac.AcoustIDReqDelay)
+		stopProgress()
+		logFailures(res.Failures)
+		for _, lookup := range lookupErrs {
+			log.Printf("unable to look up %s: %s", lookup.Fingerprint.Path(), lookup.Err)
 		}
 
 		b, err := json.Marshal(lookupRes)
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+)
+
+var (
+	cacheFile   string
+	useCache    bool
+	pruneMaxAge time.Duration
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&cacheFile, "cache-file", defaultCacheFile(), "path to the fingerprints cache database")
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheStatsCmd, cachePruneCmd, cacheClearCmd)
+	cachePruneCmd.Flags().DurationVar(&pruneMaxAge, "older-than", 30*24*time.Hour, "remove the fingerprints not used for longer than this duration")
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manages the fingerprints cache",
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Prints the number of cached fingerprints and the cache size",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		cache := mustOpenCache()
+		defer cache.Close()
+
+		stats, err := cache.Stats()
+		if err != nil {
+			return err
+		}
+
+		b, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprint(os.Stdout, string(b))
+
+		return nil
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Removes the fingerprints that haven't been used recently",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		cache := mustOpenCache()
+		defer cache.Close()
+
+		removed, err := cache.Prune(pruneMaxAge)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("removed %d fingerprints", removed)
+
+		return nil
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Removes all the cached fingerprints",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		cache := mustOpenCache()
+		defer cache.Close()
+
+		return cache.Clear()
+	},
+}
+
+// defaultCacheFile returns the cache database path in the user cache directory
+func defaultCacheFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "fingerprinter", "fingerprints.db")
+}
+
+func mustOpenCache() *fp.Cache {
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	cache, err := fp.OpenCache(cacheFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return cache
+}
+
+// newFingerprinter returns a ChromaPrint configured with opts, decorated with the
+// fingerprints cache when the --cache flag is set. The returned function must be
+// called once fingerprinting is done
+func newFingerprinter(opts ...fp.ChromaPrintOption) (fp.ContextFingerprinter, func()) {
+	chroma := newChromaPrint(opts...)
+	if !useCache {
+		return chroma, func() {}
+	}
+
+	cache := mustOpenCache()
+	done := func() {
+		if stats, err := cache.Stats(); err == nil {
+			log.Printf("cache: %d hits, %d misses, %d write errors", stats.Hits, stats.Misses, stats.WriteErrors)
+		}
+		cache.Close()
+	}
+
+	return fp.NewCachedFingerprinter(chroma, cache), done
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+)
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+}
+
+var compareCmd = &cobra.Command{
+	Use:   "compare <audiofile> <audiofile>",
+	Short: "Compares the fingerprints of two audio files and returns their similarity score and time offset",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := signalContext()
+		defer cancel()
+
+		chroma := newChromaPrint(fp.WithRawFingerprint())
+
+		similarity, err := fp.Compare(
+			mustFingerprintFile(ctx, chroma, args[0]),
+			mustFingerprintFile(ctx, chroma, args[1]),
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		b, err := json.Marshal(similarity)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Fprint(os.Stdout, string(b))
+	},
+}
+
+// mustFingerprintFile returns the fingerprint of the audio file at fPath and
+// exits when it can't be calculated
+func mustFingerprintFile(ctx context.Context, chroma *fp.ChromaPrint, fPath string) *fp.Fingerprint {
+	res, err := chroma.CalcFingerprintContext(ctx, fPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(res.Fingerprints) != 1 {
+		log.Fatalf("%s is not an audio file", fPath)
+	}
+
+	return res.Fingerprints[0]
+}
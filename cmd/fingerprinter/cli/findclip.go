@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+)
+
+var (
+	clipMaxBitErrorRate float64
+)
+
+func init() {
+	rootCmd.AddCommand(findClipCmd)
+	findClipCmd.Flags().Float64Var(&clipMaxBitErrorRate, "max-ber", fp.DefaultClipMaxBitErrorRate, "maximum bit error rate of a match, between 0 and 1")
+}
+
+var findClipCmd = &cobra.Command{
+	Use:   "findclip <recording> <clip>",
+	Short: "Finds where an audio clip occurs inside a longer recording and returns the matching offsets",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := signalContext()
+		defer cancel()
+
+		// the whole recording is searched, not only the first 120 seconds fpcalc
+		// analyses by default
+		chroma := newChromaPrint(fp.WithRawFingerprint(), fp.WithLength(0))
+
+		matches, err := fp.FindClip(
+			mustFingerprintFile(ctx, chroma, args[0]),
+			mustFingerprintFile(ctx, chroma, args[1]),
+			clipMaxBitErrorRate,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		b, err := json.Marshal(matches)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Fprint(os.Stdout, string(b))
+	},
+}
@@ -1,44 +1,110 @@
 package cli
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"os"
-	"os/exec"
+	"time"
 
-	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 
 	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
 )
 
 var (
-	inputFile string
+	inputFile     string
+	rawOutput     bool
+	fpLength      int
+	fpAlgorithm   int
+	inputRate     int
+	inputChannels int
+	chunkLength   int
+	chunkOverlap  bool
 )
 
 func init() {
 	rootCmd.AddCommand(fpCmd)
-	fpCmd.Flags().StringVarP(&inputFile, "audiofile", "a", "", "path to input audio file or directory")
+	fpCmd.Flags().StringVarP(&inputFile, "audiofile", "a", "", "path to input audio file, directory or zip/tar archive, - reads the audio from stdin")
+	fpCmd.Flags().BoolVar(&rawOutput, "raw", false, "include the uncompressed fingerprint values in the output")
+	fpCmd.Flags().IntVar(&fpLength, "length", 120, "seconds of audio analysed from the beginning of each file, 0 analyses whole files")
+	fpCmd.Flags().IntVar(&fpAlgorithm, "algorithm", 2, "fingerprinting algorithm")
+	fpCmd.Flags().IntVar(&inputRate, "rate", 0, "sample rate of the input audio")
+	fpCmd.Flags().IntVar(&inputChannels, "channels", 0, "number of channels of the input audio")
+	fpCmd.Flags().IntVar(&chunkLength, "chunk", 0, "split files into chunks of this many seconds and fingerprint each chunk")
+	fpCmd.Flags().BoolVar(&chunkOverlap, "overlap", false, "overlap the chunks slightly")
 	fpCmd.MarkFlagRequired("audiofile")
+	addScanFlags(fpCmd)
+	addProgressFlag(fpCmd)
 }
 
 var fpCmd = &cobra.Command{
 	Use:   "fpcalc",
-	Short: "Calculates the fingerprint of the input mp3 audio file",
-	Run: func(cmd *cobra.Command, args []string) {
-		chroma := fp.NewChromaPrint(exec.Command, afero.NewOsFs())
+	Short: "Calculates the fingerprint of the input audio file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
 
-		fingerprints, err := chroma.CalcFingerprint(inputFile)
-		if err != nil {
-			log.Fatal(err)
+		ctx, cancel := signalContext()
+		defer cancel()
+
+		opts := append(scanOptions(), fp.WithInputFormat(inputRate, inputChannels))
+		if rawOutput {
+			opts = append(opts, fp.WithRawFingerprint())
+		}
+		if cmd.Flags().Changed("length") {
+			opts = append(opts, fp.WithLength(time.Duration(fpLength)*time.Second))
+		}
+		if cmd.Flags().Changed("algorithm") {
+			opts = append(opts, fp.WithAlgorithm(fpAlgorithm))
+		}
+		if chunkLength > 0 {
+			opts = append(opts, fp.WithChunks(time.Duration(chunkLength)*time.Second, chunkOverlap))
+		}
+
+		if inputFile == "-" {
+			return fingerprintStdin(ctx, newChromaPrint(opts...))
+		}
+
+		progress, stopProgress := newProgress()
+		defer stopProgress()
+
+		chroma, done := newFingerprinter(append(opts, fp.WithProgress(progress))...)
+		defer done()
+
+		// an interrupted scan still prints the fingerprints calculated so far
+		res, scanErr := chroma.CalcFingerprintContext(ctx, inputFile)
+		stopProgress()
+		if res == nil {
+			return scanErr
 		}
 
-		b, err := json.Marshal(fingerprints)
+		logFailures(res.Failures)
+
+		b, err := json.Marshal(res.Fingerprints)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		fmt.Fprint(os.Stdout, string(b))
+
+		return scanErr
 	},
 }
+
+// fingerprintStdin prints the fingerprint of the audio read from stdin. Streams
+// have no stable content to key the cache on, so they are never cached
+func fingerprintStdin(ctx context.Context, chroma *fp.ChromaPrint) error {
+	f, err := chroma.CalcFingerprintReader(ctx, os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal([]*fp.Fingerprint{f})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(os.Stdout, string(b))
+
+	return nil
+}
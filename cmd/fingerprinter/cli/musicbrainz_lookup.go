@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -31,7 +32,7 @@ var mbCmd = &cobra.Command{
 	Use:   "mblookup",
 	Short: "Queries the MusicBrainz API and returns recordings and releases metadata associated with a recording ID",
 	Run: func(cmd *cobra.Command, args []string) {
-		mbClient := mb.NewMusicBrainz(appName, semVer, contactEmail)
+		mbClient := newMusicBrainz()
 		recInfo, err := mbClient.GetReleaseInfo(releaseID)
 		if err != nil {
 			log.Fatal(err)
@@ -45,3 +46,11 @@ var mbCmd = &cobra.Command{
 		fmt.Fprint(os.Stdout, string(b))
 	},
 }
+
+// newMusicBrainz returns the MusicBrainz client configured by the flags
+func newMusicBrainz() *mb.MusicBrainz {
+	return mb.NewMusicBrainz(appName, semVer, contactEmail,
+		mb.WithRateLimit(musicBrainzRate, time.Second),
+		mb.WithRateLimitLockFile(rateLimitLockFile("musicbrainz")),
+	)
+}
@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+)
+
+const (
+	progressBarWidth = 30
+	// progressRedraw limits how often the progress bar is redrawn
+	progressRedraw = 100 * time.Millisecond
+	// progressLogInterval is the interval between progress log lines when stderr
+	// isn't a terminal
+	progressLogInterval = 10 * time.Second
+)
+
+var showProgress bool
+
+// addProgressFlag adds the flag controlling the progress output of long scans
+func addProgressFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&showProgress, "progress", true, "report the scan progress on stderr")
+}
+
+// progressRenderer writes the progress of a scan to stderr, as a progress bar
+// redrawn in place on a terminal and as periodic log lines otherwise. While the
+// bar is shown the log output goes through the renderer, so that log lines don't
+// break the bar
+type progressRenderer struct {
+	mu    sync.Mutex
+	out   io.Writer
+	tty   bool
+	last  fp.ProgressEvent
+	drawn time.Time
+	// logOut is the log output replaced by the renderer on a terminal
+	logOut   io.Writer
+	stopOnce sync.Once
+}
+
+// newProgress returns the tracker of the scan progress, nil when --progress is
+// false. The returned function stops rendering the progress, it can be called
+// more than once
+func newProgress() (*fp.ProgressTracker, func()) {
+	if !showProgress {
+		return nil, func() {}
+	}
+
+	r := &progressRenderer{out: os.Stderr, tty: isTerminal(os.Stderr), logOut: log.Writer()}
+	if r.tty {
+		log.SetOutput(r)
+	}
+
+	return fp.NewProgressTracker(r.render), r.stop
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func (r *progressRenderer) render(e fp.ProgressEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.last = e
+
+	interval := progressLogInterval
+	if r.tty {
+		interval = progressRedraw
+	}
+	if time.Since(r.drawn) < interval {
+		return
+	}
+	r.drawn = time.Now()
+
+	if r.tty {
+		r.drawBar()
+		return
+	}
+
+	log.Printf("progress: %s", progressSummary(e))
+}
+
+// Write writes the log lines above the progress bar
+func (r *progressRenderer) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprint(r.out, "\r\033[K")
+	n, err := r.out.Write(p)
+	r.drawBar()
+
+	return n, err
+}
+
+// drawBar redraws the progress bar on the current line
+func (r *progressRenderer) drawBar() {
+	e := r.last
+	if e.Discovered == 0 {
+		return
+	}
+
+	done, total := e.Fingerprinted+e.Failed, e.Discovered
+	if e.LookedUp > 0 {
+		done, total = e.LookedUp, e.Fingerprinted
+	}
+	if done > total {
+		done = total
+	}
+
+	filled := progressBarWidth * done / total
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+
+	fmt.Fprintf(r.out, "\r\033[K[%s] %s", bar, progressSummary(e))
+}
+
+// stop renders the final progress and restores the log output
+func (r *progressRenderer) stop() {
+	r.stopOnce.Do(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.tty {
+			log.SetOutput(r.logOut)
+			if r.last.Discovered > 0 {
+				r.drawBar()
+				fmt.Fprintln(r.out)
+			}
+			return
+		}
+
+		if r.last.Discovered > 0 {
+			log.Printf("progress: %s", progressSummary(r.last))
+		}
+	})
+}
+
+func progressSummary(e fp.ProgressEvent) string {
+	summary := fmt.Sprintf("%d/%d fingerprinted, %d failed", e.Fingerprinted, e.Discovered, e.Failed)
+	if e.LookedUp > 0 {
+		summary += fmt.Sprintf(", %d/%d looked up", e.LookedUp, e.Fingerprinted)
+	}
+
+	summary += fmt.Sprintf(", elapsed %s", e.Elapsed.Round(time.Second))
+	if e.ETA > 0 {
+		summary += fmt.Sprintf(", ETA %s", e.ETA.Round(time.Second))
+	}
+
+	return summary
+}
@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"path/filepath"
+
+	ac "github.com/ocramh/fingerprinter/pkg/acoustid"
+	mb "github.com/ocramh/fingerprinter/pkg/musicbrainz"
+)
+
+var (
+	acoustIDRate    int
+	musicBrainzRate int
+	rateLimitDir    string
+)
+
+func init() {
+	rootCmd.PersistentFlags().IntVar(&acoustIDRate, "acoustid-rate", ac.DefaultRateLimit, "maximum number of AcoustID requests per second")
+	rootCmd.PersistentFlags().IntVar(&musicBrainzRate, "musicbrainz-rate", mb.DefaultRateLimit, "maximum number of MusicBrainz requests per second")
+	rootCmd.PersistentFlags().StringVar(&rateLimitDir, "rate-limit-dir", "", "directory of the lock files sharing the rate limits with other fingerprinter processes")
+}
+
+// rateLimitLockFile returns the lock file of the rate limit of an API, "" when
+// the rate limits aren't shared
+func rateLimitLockFile(api string) string {
+	if rateLimitDir == "" {
+		return ""
+	}
+
+	return filepath.Join(rateLimitDir, api+".lock")
+}
@@ -1,20 +1,69 @@
 package cli
 
 import (
-	"fmt"
+	"context"
+	"log"
 	"os"
+	"os/exec"
+	"os/signal"
 
+	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
+
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+)
+
+var (
+	fpcalcPath string
 )
 
+func init() {
+	rootCmd.PersistentFlags().StringVar(&fpcalcPath, "fpcalc", "", "path to the fpcalc executable, looked up in PATH by default")
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "fingerprinter",
 	Short: "audio files fingerprinting and metadata fetcher",
+	// errors are logged by RunCLI once the command has cleaned up
+	SilenceErrors: true,
 }
 
 func RunCLI() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		log.Fatal(err)
+	}
+}
+
+// signalContext returns a context that is cancelled when the process receives
+// an interrupt signal, so that running commands can stop cleanly
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+
+	go func() {
+		defer signal.Stop(sigs)
+
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// newChromaPrint returns a ChromaPrint running the fpcalc executable set with the
+// --fpcalc flag and exits when it can't be used
+func newChromaPrint(opts ...fp.ChromaPrintOption) *fp.ChromaPrint {
+	opts = append(opts, fp.WithFPcalcPath(fpcalcPath))
+
+	chroma, err := fp.NewChromaPrint(exec.Command, afero.NewOsFs(), opts...)
+	if err != nil {
+		log.Fatal(err)
 	}
+
+	return chroma
 }
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"log"
+	"runtime"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+)
+
+var (
+	recursive       bool
+	maxDepth        int
+	includePatterns []string
+	excludePatterns []string
+	followSymlinks  bool
+	concurrency     int
+	fileTimeout     time.Duration
+	archiveEntries  int
+	archiveBytes    int64
+)
+
+// addScanFlags adds the flags controlling how input directories and archives
+// are scanned
+func addScanFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "scan subdirectories")
+	cmd.Flags().IntVar(&maxDepth, "max-depth", 0, "maximum number of subdirectory levels to scan, 0 means no limit")
+	cmd.Flags().StringSliceVar(&includePatterns, "include", nil, "only scan files matching these glob patterns")
+	cmd.Flags().StringSliceVar(&excludePatterns, "exclude", nil, "skip files and directories matching these glob patterns")
+	cmd.Flags().BoolVar(&followSymlinks, "follow-symlinks", false, "follow symbolic links")
+	cmd.Flags().IntVarP(&concurrency, "concurrency", "j", runtime.NumCPU(), "maximum number of files fingerprinted in parallel")
+	cmd.Flags().DurationVar(&fileTimeout, "timeout", 0, "maximum time spent fingerprinting each file, 0 means no limit")
+	cmd.Flags().IntVar(&archiveEntries, "archive-max-entries", fp.DefaultArchiveMaxEntries, "maximum number of entries of an input archive")
+	cmd.Flags().Int64Var(&archiveBytes, "archive-max-bytes", fp.DefaultArchiveMaxBytes, "maximum decompressed size in bytes of an input archive")
+	cmd.Flags().BoolVar(&useCache, "cache", false, "reuse the fingerprints stored in the cache and cache the new ones")
+}
+
+// scanOptions returns the ChromaPrint options set by the scan flags
+func scanOptions() []fp.ChromaPrintOption {
+	opts := []fp.ChromaPrintOption{
+		fp.WithIncludePatterns(includePatterns...),
+		fp.WithExcludePatterns(excludePatterns...),
+		fp.WithFollowSymlinks(followSymlinks),
+		fp.WithConcurrency(concurrency),
+		fp.WithFileTimeout(fileTimeout),
+		fp.WithArchiveLimits(archiveEntries, archiveBytes),
+	}
+
+	if recursive {
+		opts = append(opts, fp.WithRecursion(maxDepth))
+	}
+
+	return opts
+}
+
+// logFailures writes the files that couldn't be fingerprinted to stderr
+func logFailures(failures []*fp.FileError) {
+	for _, failure := range failures {
+		log.Printf("skipping %s", failure)
+	}
+}
@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	ac "github.com/ocramh/fingerprinter/pkg/acoustid"
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+)
+
+var (
+	userKey     string
+	submitInput string
+)
+
+func init() {
+	rootCmd.AddCommand(submitCmd)
+	submitCmd.Flags().StringVarP(&apikey, "apikey", "k", "", "acoustid key")
+	submitCmd.Flags().StringVarP(&userKey, "userkey", "u", "", "acoustid user API key of the contributor")
+	submitCmd.Flags().StringVarP(&submitInput, "input", "i", "", "JSON lines file of the recordings to submit, - for stdin")
+	submitCmd.Flags().StringVarP(&appName, "appname", "n", "fingerprinter", "the name of the application")
+	submitCmd.Flags().StringVarP(&semVer, "semver", "s", "0.0.1", "the application semantic version")
+	submitCmd.MarkFlagRequired("apikey")
+	submitCmd.MarkFlagRequired("userkey")
+	submitCmd.MarkFlagRequired("input")
+	addAcoustIDFlags(submitCmd)
+	addScanFlags(submitCmd)
+}
+
+// submitEntry is a line of the submit input: an audio file along with its
+// MusicBrainz recording ID or its metadata
+type submitEntry struct {
+	Path        string `json:"path"`
+	MBID        string `json:"mbid"`
+	Track       string `json:"track"`
+	Artist      string `json:"artist"`
+	Album       string `json:"album"`
+	AlbumArtist string `json:"albumartist"`
+	Year        int    `json:"year"`
+	TrackNo     int    `json:"trackno"`
+	DiscNo      int    `json:"discno"`
+}
+
+// submitRecord is the outcome of the submission of an audio file
+type submitRecord struct {
+	Path string `json:"path"`
+	ac.SubmissionResult
+}
+
+var submitCmd = &cobra.Command{
+	Use:   "submit",
+	Short: "Fingerprints audio files and submits them to AcoustID along with their MusicBrainz recording ID or metadata",
+	Long: `Fingerprints audio files and submits them to AcoustID along with their MusicBrainz recording ID or metadata.
+
+Each line of the input is a JSON object describing a single audio file, e.g.
+  {"path": "track.mp3", "mbid": "d4d24fa2-22f5-4b02-8751-8c0cf9cd02b2"}
+  {"path": "other.mp3", "track": "Ice Cream", "artist": "Battles", "album": "La Di Da Di", "year": 2015}`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := signalContext()
+		defer cancel()
+
+		entries, err := readSubmitEntries(submitInput)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		chroma, done := newFingerprinter(scanOptions()...)
+		defer done()
+
+		var submissions []ac.Submission
+		var paths []string
+		for _, entry := range entries {
+			res, err := chroma.CalcFingerprintContext(ctx, entry.Path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			logFailures(res.Failures)
+
+			// the metadata of an entry describes a single audio file, so
+			// directories and archives are rejected
+			if len(res.Fingerprints) != 1 {
+				log.Fatalf("%s: expected a single audio file, got %d fingerprints", entry.Path, len(res.Fingerprints))
+			}
+
+			submissions = append(submissions, entry.submission(res.Fingerprints[0]))
+			paths = append(paths, entry.Path)
+		}
+
+		results, err := newAcoustID().Submit(ctx, userKey, submissions)
+		if err != nil && results == nil {
+			log.Fatal(err)
+		}
+
+		records := make([]submitRecord, len(results))
+		for i, result := range results {
+			records[i] = submitRecord{Path: paths[i], SubmissionResult: result}
+		}
+
+		b, jsonErr := json.Marshal(records)
+		if jsonErr != nil {
+			log.Fatal(jsonErr)
+		}
+		fmt.Fprint(os.Stdout, string(b))
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func (e submitEntry) submission(f *fp.Fingerprint) ac.Submission {
+	return ac.Submission{
+		Fingerprint: f,
+		MBID:        e.MBID,
+		Track:       e.Track,
+		Artist:      e.Artist,
+		Album:       e.Album,
+		AlbumArtist: e.AlbumArtist,
+		Year:        e.Year,
+		TrackNo:     e.TrackNo,
+		DiscNo:      e.DiscNo,
+	}
+}
+
+// readSubmitEntries reads the JSON lines of the file at path, or of stdin when
+// path is "-"
+func readSubmitEntries(path string) ([]submitEntry, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var entries []submitEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry submitEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid submit input line %d: %w", line, err)
+		}
+		if entry.Path == "" {
+			return nil, fmt.Errorf("invalid submit input line %d: missing path", line)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
@@ -2,14 +2,10 @@ package cli
 
 import (
 	"fmt"
-	"os/exec"
 
-	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 
-	ac "github.com/ocramh/fingerprinter/pkg/acoustid"
 	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
-	mb "github.com/ocramh/fingerprinter/pkg/musicbrainz"
 	vf "github.com/ocramh/fingerprinter/pkg/verifier"
 )
 
@@ -27,19 +23,30 @@ func init() {
 	verifyCmd.MarkFlagRequired("apikey")
 	verifyCmd.MarkFlagRequired("audiopath")
 	verifyCmd.MarkFlagRequired("email")
+	addAcoustIDFlags(verifyCmd)
+	addScanFlags(verifyCmd)
+	addProgressFlag(verifyCmd)
 }
 
 var verifyCmd = &cobra.Command{
 	Use:   "verify",
 	Short: "Verifies input audio metadata and returns the associated relase(s) info if a match was found",
 	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := signalContext()
+		defer cancel()
 
-		chPrint := fp.NewChromaPrint(exec.Command, afero.NewOsFs())
-		acClient := ac.NewAcoustID(apikey)
-		mbClient := mb.NewMusicBrainz(appName, semVer, contactEmail)
+		progress, stopProgress := newProgress()
+		defer stopProgress()
 
-		verifier := vf.NewAudioVerifier(chPrint, acClient, mbClient)
-		res, err := verifier.Analyze(audioPath)
+		chPrint, done := newFingerprinter(append(scanOptions(), fp.WithProgress(progress))...)
+		defer done()
+
+		acClient := newAcoustID()
+		mbClient := newMusicBrainz()
+
+		verifier := vf.NewAudioVerifier(chPrint, acClient, mbClient, vf.WithProgress(progress))
+		res, err := verifier.AnalyzeContext(ctx, audioPath)
+		stopProgress()
 		if err != nil {
 			panic(err)
 		}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	ac "github.com/ocramh/fingerprinter/pkg/acoustid"
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+	mb "github.com/ocramh/fingerprinter/pkg/musicbrainz"
+	vf "github.com/ocramh/fingerprinter/pkg/verifier"
+	"github.com/ocramh/fingerprinter/pkg/watch"
+)
+
+var (
+	debounce    time.Duration
+	verifyFiles bool
+)
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().DurationVar(&debounce, "debounce", watch.DefaultDebounce, "time a file must stay unchanged before being fingerprinted")
+	watchCmd.Flags().BoolVar(&verifyFiles, "verify", false, "verify the fingerprinted files and output their release(s) info")
+	watchCmd.Flags().StringVarP(&apikey, "apikey", "k", "", "acoustid key, required by --verify")
+	watchCmd.Flags().StringVarP(&appName, "appname", "n", "fingerprinter", "the name of the application")
+	watchCmd.Flags().StringVarP(&semVer, "semver", "s", "0.0.1", "the application semantic version")
+	watchCmd.Flags().StringVarP(&contactEmail, "email", "e", "", "contact email address, required by --verify")
+	addAcoustIDFlags(watchCmd)
+	addScanFlags(watchCmd)
+}
+
+// watchRecord is the NDJSON record written for each file. Analysis is only set
+// by --verify
+type watchRecord struct {
+	watch.Result
+	Analysis *vf.RecAnalysis `json:"analysis,omitempty"`
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch <directory>",
+	Short: "Watches a directory tree and fingerprints the audio files added to it, writing one JSON record per line",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if verifyFiles && (apikey == "" || contactEmail == "") {
+			log.Fatal("--verify requires --apikey and --email")
+		}
+
+		ctx, cancel := signalContext()
+		defer cancel()
+
+		chroma, done := newFingerprinter(scanOptions()...)
+		defer done()
+
+		// the clients are shared by all the files, so that their rate limits
+		// apply across files
+		var acClient *ac.AcoustID
+		var mbClient *mb.MusicBrainz
+		if verifyFiles {
+			acClient, mbClient = newAcoustID(), newMusicBrainz()
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		handle := func(ctx context.Context, res watch.Result) {
+			record := watchRecord{Result: res}
+			if verifyFiles && res.Fingerprint != nil {
+				record.Analysis = verifyFingerprint(ctx, vf.NewAudioVerifier(chroma, acClient, mbClient), res.Fingerprint)
+			}
+
+			if err := enc.Encode(record); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		w := watch.NewWatcher(chroma, watch.WithDebounce(debounce), watch.WithConcurrency(concurrency))
+		if err := w.Run(ctx, args[0], handle); err != nil && err != context.Canceled {
+			log.Fatal(err)
+		}
+	},
+}
+
+// verifyFingerprint returns the analysis of a single fingerprint, or nil if it
+// fails. The verifier must not be reused, as it collects the releases of all the
+// analysed fingerprints
+func verifyFingerprint(ctx context.Context, verifier *vf.AudioVerifier, fing *fp.Fingerprint) *vf.RecAnalysis {
+	analysis, err := verifier.AnalyzeBatch(ctx, &fp.BatchResult{Fingerprints: []*fp.Fingerprint{fing}})
+	if err != nil {
+		log.Printf("unable to verify %s: %s", fing.Path(), err)
+		return nil
+	}
+
+	return analysis
+}
@@ -3,8 +3,10 @@ module github.com/ocramh/fingerprinter
 go 1.15
 
 require (
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/jarcoal/httpmock v1.0.8
 	github.com/spf13/afero v1.1.2
 	github.com/spf13/cobra v1.1.3
 	github.com/stretchr/testify v1.3.0
+	go.etcd.io/bbolt v1.3.5
 )
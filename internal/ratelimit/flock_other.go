@@ -0,0 +1,19 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package ratelimit
+
+import (
+	"errors"
+	"os"
+)
+
+var errLockUnsupported = errors.New("lock files are not supported on this platform")
+
+func lockFile(f *os.File) error {
+	return errLockUnsupported
+}
+
+func unlockFile(f *os.File) error {
+	return errLockUnsupported
+}
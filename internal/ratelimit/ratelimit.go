@@ -0,0 +1,185 @@
+// Package ratelimit implements the token bucket limiting the rate of the
+// requests sent to the web APIs. A bucket can be shared by the processes of a
+// host through a lock file
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Limiter allows up to a number of requests per period. Its bucket holds a
+// single token, refilled continuously, so that requests are evenly spaced and no
+// period ever holds more than the allowed requests. It is safe for concurrent
+// use, and a nil *Limiter never blocks
+type Limiter struct {
+	mu sync.Mutex
+	// interval is the time needed to refill the token
+	interval time.Duration
+	// lockFile stores the bucket shared with other processes, when set
+	lockFile string
+	bucket   bucket
+}
+
+// bucket is the state of a token bucket. Tokens is negative when requests are
+// waiting for the bucket to refill
+type bucket struct {
+	Tokens float64   `json:"tokens"`
+	Last   time.Time `json:"last"`
+}
+
+// New returns a Limiter allowing requests per period, sent at least per/requests
+// apart
+func New(requests int, per time.Duration) *Limiter {
+	if requests < 1 {
+		requests = 1
+	}
+
+	// the interval is rounded up, so that requests never fit in less than per
+	return &Limiter{
+		interval: (per + time.Duration(requests) - 1) / time.Duration(requests),
+	}
+}
+
+// NewShared is like New but shares the bucket with the other processes using the
+// same lock file. The file is created if it doesn't exist
+func NewShared(requests int, per time.Duration, lockFile string) *Limiter {
+	l := New(requests, per)
+	l.lockFile = lockFile
+
+	return l
+}
+
+// Wait blocks until a request can be sent or ctx is done. The token reserved for
+// the request is given back when ctx is done first
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	delay, err := l.reserve(time.Now())
+	if err != nil {
+		return err
+	}
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.release()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token from the bucket and returns how long the request must
+// wait for it
+func (l *Limiter) reserve(now time.Time) (time.Duration, error) {
+	var delay time.Duration
+	err := l.update(func(b *bucket) {
+		delay = b.take(now, l.interval)
+	})
+
+	return delay, err
+}
+
+// release gives back a token reserved by a request that wasn't sent. Errors are
+// ignored, the next requests are then only delayed
+func (l *Limiter) release() {
+	l.update(func(b *bucket) {
+		b.put()
+	})
+}
+
+// update calls fn with the bucket of the Limiter, shared or not
+func (l *Limiter) update(fn func(b *bucket)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.lockFile == "" {
+		fn(&l.bucket)
+		return nil
+	}
+
+	return l.updateShared(fn)
+}
+
+// updateShared calls fn with the bucket stored in the lock file, which is locked
+// while the bucket is updated. An unreadable bucket is reset
+func (l *Limiter) updateShared(fn func(b *bucket)) error {
+	f, err := os.OpenFile(l.lockFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open rate limit lock file: %w", err)
+	}
+	defer f.Close()
+
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("unable to lock rate limit lock file: %w", err)
+	}
+	defer unlockFile(f)
+
+	var b bucket
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 && json.Unmarshal(data, &b) != nil {
+		b = bucket{}
+	}
+
+	fn(&b)
+
+	data, err = json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = f.WriteAt(data, 0)
+
+	return err
+}
+
+// take refills the bucket for the time elapsed since the last request and takes
+// its token. When the bucket is empty the token is borrowed, and the returned
+// delay is the time needed to refill it
+func (b *bucket) take(now time.Time, interval time.Duration) time.Duration {
+	if b.Last.IsZero() {
+		b.Tokens = 1
+		b.Last = now
+	}
+
+	if now.After(b.Last) {
+		b.Tokens += float64(now.Sub(b.Last)) / float64(interval)
+		if b.Tokens > 1 {
+			b.Tokens = 1
+		}
+		b.Last = now
+	}
+
+	b.Tokens--
+	if b.Tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.Tokens * float64(interval))
+}
+
+// put gives back a token taken from the bucket
+func (b *bucket) put() {
+	b.Tokens++
+	if b.Tokens > 1 {
+		b.Tokens = 1
+	}
+}
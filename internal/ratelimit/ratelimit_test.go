@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketTake(t *testing.T) {
+	var b bucket
+	now := time.Now()
+
+	// the first request is sent right away, then each request waits for the
+	// token
+	assert.Equal(t, time.Duration(0), b.take(now, 100*time.Millisecond))
+	assert.Equal(t, 100*time.Millisecond, b.take(now, 100*time.Millisecond))
+	assert.Equal(t, 200*time.Millisecond, b.take(now, 100*time.Millisecond))
+
+	// the borrowed tokens are paid back before new requests are allowed
+	now = now.Add(250 * time.Millisecond)
+	assert.Equal(t, 50*time.Millisecond, b.take(now, 100*time.Millisecond))
+
+	// the bucket doesn't refill above a token
+	now = now.Add(time.Hour)
+	assert.Equal(t, time.Duration(0), b.take(now, 100*time.Millisecond))
+	assert.Equal(t, 100*time.Millisecond, b.take(now, 100*time.Millisecond))
+
+	// a token given back is available to the next request
+	b.put()
+	assert.Equal(t, 100*time.Millisecond, b.take(now, 100*time.Millisecond))
+}
+
+// assertWindows asserts that no window of length per holds more than requests
+// of the sorted send times
+func assertWindows(t *testing.T, sent []time.Time, requests int, per time.Duration) {
+	for i := requests; i < len(sent); i++ {
+		window := sent[i].Sub(sent[i-requests])
+		assert.True(t, window >= per, "requests %d to %d sent within %s", i-requests, i, window)
+	}
+}
+
+func TestLimiterWindows(t *testing.T) {
+	l := New(3, time.Second)
+
+	// requests arriving in bursts and after idle periods
+	now := time.Now()
+	var sent []time.Time
+	for _, gap := range []time.Duration{0, 0, 0, 0, 10 * time.Millisecond, 5 * time.Second, 0, 0, 0, 900 * time.Millisecond, 0, 0} {
+		now = now.Add(gap)
+		delay, err := l.reserve(now)
+		assert.NoError(t, err)
+		sent = append(sent, now.Add(delay))
+	}
+
+	sort.Slice(sent, func(i, j int) bool { return sent[i].Before(sent[j]) })
+	assertWindows(t, sent, 3, time.Second)
+}
+
+func TestLimiterWaitConcurrent(t *testing.T) {
+	per := 100 * time.Millisecond
+	l := New(2, per)
+
+	start := time.Now()
+	var mu sync.Mutex
+	var elapsed []time.Duration
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, l.Wait(context.Background()))
+
+			mu.Lock()
+			elapsed = append(elapsed, time.Since(start))
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// the requests are sent every 50ms
+	sort.Slice(elapsed, func(i, j int) bool { return elapsed[i] < elapsed[j] })
+	for i, e := range elapsed {
+		assert.True(t, e >= time.Duration(i)*per/2, "request %d sent after %s", i, e)
+	}
+	assert.True(t, elapsed[len(elapsed)-1] < time.Second, "elapsed %s", elapsed[len(elapsed)-1])
+}
+
+func TestLimiterWaitCancelled(t *testing.T) {
+	l := New(1, 100*time.Millisecond)
+	assert.NoError(t, l.Wait(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, l.Wait(ctx))
+
+	// the cancelled request gave its token back, so the next request only waits
+	// for the first one
+	start := time.Now()
+	assert.NoError(t, l.Wait(context.Background()))
+	assert.True(t, time.Since(start) < 150*time.Millisecond, "waited %s", time.Since(start))
+}
+
+func TestLimiterNil(t *testing.T) {
+	var l *Limiter
+	assert.NoError(t, l.Wait(context.Background()))
+}
+
+func TestSharedLimiter(t *testing.T) {
+	lockFile := filepath.Join(t.TempDir(), "acoustid.lock")
+	l1 := NewShared(1, time.Hour, lockFile)
+	l2 := NewShared(1, time.Hour, lockFile)
+
+	assert.NoError(t, l1.Wait(context.Background()))
+
+	// the token was taken by the first limiter
+	delay, err := l2.reserve(time.Now())
+	assert.NoError(t, err)
+	assert.True(t, delay > 59*time.Minute, "delay %s", delay)
+
+	// tokens given back are shared too
+	l2.release()
+	delay, err = l2.reserve(time.Now())
+	assert.NoError(t, err)
+	assert.True(t, delay > 59*time.Minute && delay <= time.Hour, "delay %s", delay)
+
+	// an unreadable bucket is reset
+	assert.NoError(t, ioutil.WriteFile(lockFile, []byte("garbage"), 0644))
+	delay, err = l2.reserve(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), delay)
+}
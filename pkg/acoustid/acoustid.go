@@ -2,7 +2,9 @@ package acoustid
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -11,15 +13,25 @@ import (
 	"time"
 
 	hc "github.com/ocramh/fingerprinter/internal/httpclient"
+	"github.com/ocramh/fingerprinter/internal/ratelimit"
 	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
 )
 
 const (
+	// DefaultEndpoint is the root URL of the AcoustID API
+	DefaultEndpoint = "https://api.acoustid.org/v2"
+
 	// AcoustIDBaseURL is the base URL used for queries the acoustid API
-	AcoustIDBaseURL = "https://api.acoustid.org/v2/lookup"
+	AcoustIDBaseURL = DefaultEndpoint + lookupPath
+
+	lookupPath = "/lookup"
+
+	// DefaultRateLimit is the number of requests per second allowed by the API
+	DefaultRateLimit = 3
 
-	// The delay requests should respect when being fired in succession
-	AcoustIDReqDelay = 1 * time.Second
+	// LookupBatchSize is the maximum number of fingerprints looked up with a
+	// single request
+	LookupBatchSize = 20
 )
 
 var (
@@ -32,64 +44,199 @@ var (
 // It requires an API key that can be generated by registering an application at
 // https://acoustid.org/login?return_url=https%3A%2F%2Facoustid.org%2Fnew-application
 type AcoustID struct {
-	apiKey string
+	apiKey     string
+	endpoint   string
+	httpClient *http.Client
+	userAgent  string
+	limiter    *ratelimit.Limiter
+	retry      RetryPolicy
+
+	clientVersion string
+	pollInterval  time.Duration
 }
 
 // NewAcoustID is the AcoustID constructor
-func NewAcoustID(k string) *AcoustID {
-	return &AcoustID{k}
+func NewAcoustID(k string, opts ...Option) *AcoustID {
+	cfg := clientConfig{
+		endpoint:     DefaultEndpoint,
+		rateRequests: DefaultRateLimit,
+		ratePer:      time.Second,
+		retry:        DefaultRetryPolicy,
+		pollInterval: DefaultPollInterval,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &AcoustID{
+		apiKey:     k,
+		endpoint:   cfg.endpoint,
+		httpClient: cfg.client(),
+		userAgent:  cfg.userAgent,
+		limiter:    cfg.limiter(),
+		retry:      cfg.retry,
+
+		clientVersion: cfg.clientVersion,
+		pollInterval:  cfg.pollInterval,
+	}
 }
 
 // LookupFingerprint uses audio fingerprints and duration values to search the
 // AcoustID fingerprint database and return the corresponding track ID and MusicBrainz
 // recording ID if a match was found
-func (a *AcoustID) LookupFingerprint(f *fp.Fingerprint, withRetry bool) (*AcoustIDLookupResp, error) {
-	resp, err := a.doHTTPRequest((f))
-	if err != nil {
+func (a *AcoustID) LookupFingerprint(f *fp.Fingerprint) (*AcoustIDLookupResp, error) {
+	var lookupResp AcoustIDLookupResp
+	if err := a.post(context.Background(), lookupPath, a.buildLookupQueryVals(f), &lookupResp, true); err != nil {
 		return nil, err
 	}
+
+	return &lookupResp, nil
+}
+
+// LookupFingerprints is like LookupFingerprint but looks up many fingerprints
+// with as few requests as possible. Each request contains up to LookupBatchSize
+// fingerprints. The results are returned in the same order as fingerprints.
+// When a request fails the Err of its results is set and the next requests are
+// still sent. An error is only returned when ctx is done, along with the results
+// of the completed requests
+func (a *AcoustID) LookupFingerprints(ctx context.Context, fingerprints []*fp.Fingerprint) ([]BatchLookupResult, error) {
+	return a.LookupFingerprintsFunc(ctx, fingerprints, nil)
+}
+
+// LookupFingerprintsFunc is like LookupFingerprints but calls fn with the
+// results of each request as soon as it completes, e.g. to report progress. fn
+// may be nil
+func (a *AcoustID) LookupFingerprintsFunc(ctx context.Context, fingerprints []*fp.Fingerprint, fn func([]BatchLookupResult)) ([]BatchLookupResult, error) {
+	results := make([]BatchLookupResult, 0, len(fingerprints))
+
+	for start := 0; start < len(fingerprints); start += LookupBatchSize {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		end := start + LookupBatchSize
+		if end > len(fingerprints) {
+			end = len(fingerprints)
+		}
+
+		batch, err := a.lookupBatch(ctx, fingerprints[start:end])
+		if err != nil {
+			if ctx.Err() != nil {
+				return results, ctx.Err()
+			}
+
+			for i := range batch {
+				batch[i].Err = err
+			}
+		}
+
+		if fn != nil {
+			fn(batch)
+		}
+		results = append(results, batch...)
+	}
+
+	return results, nil
+}
+
+// lookupBatch looks up up to LookupBatchSize fingerprints with a single request.
+// The results hold the fingerprints even when the request fails
+func (a *AcoustID) lookupBatch(ctx context.Context, fingerprints []*fp.Fingerprint) ([]BatchLookupResult, error) {
+	results := make([]BatchLookupResult, len(fingerprints))
+	for i, f := range fingerprints {
+		results[i].Fingerprint = f
+	}
+
+	var lookupResp batchLookupResp
+	if err := a.post(ctx, lookupPath, a.buildBatchLookupQueryVals(fingerprints), &lookupResp, true); err != nil {
+		return results, err
+	}
+
+	indexes := make([]int, len(lookupResp.Fingerprints))
+	for n, fingerprintResp := range lookupResp.Fingerprints {
+		i, err := fingerprintResp.Index.Int64()
+		if err != nil || i < 0 || int(i) >= len(fingerprints) {
+			return results, fmt.Errorf("invalid fingerprint index in lookup response: %s", fingerprintResp.Index)
+		}
+		indexes[n] = int(i)
+	}
+
+	for n, i := range indexes {
+		results[i].Results = lookupResp.Fingerprints[n].Results
+	}
+
+	return results, nil
+}
+
+// post posts the query values to the API path and decodes the response into v.
+// Failed requests are retried according to the retry policy of the client.
+// Requests that aren't idempotent are only retried when the server rejected
+// them without processing them, see isRejectedStatus
+func (a *AcoustID) post(ctx context.Context, path string, values url.Values, v interface{}, idempotent bool) error {
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		wait, retryable, err := a.postOnce(ctx, path, values, v, idempotent)
+		if err == nil || !retryable {
+			return err
+		}
+
+		delay, ok := a.retry.next(attempt, time.Since(start), wait)
+		if !ok {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// postOnce sends a single request. When it fails it reports whether the request
+// can be retried, and the delay asked by the server if any
+func (a *AcoustID) postOnce(ctx context.Context, path string, values url.Values, v interface{}, idempotent bool) (time.Duration, bool, error) {
+	resp, err := a.doHTTPRequest(ctx, path, values)
+	if err != nil {
+		return 0, idempotent && isRetryableErr(ctx, err), err
+	}
 	defer resp.Body.Close()
 
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return 0, idempotent && isRetryableErr(ctx, err), err
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		if resp.StatusCode == http.StatusServiceUnavailable {
-			if withRetry {
-				time.Sleep(retryAfterSec(resp))
-				return a.LookupFingerprint(f, false)
-			}
-
-			return nil, hc.NewHTTPError(http.StatusServiceUnavailable, "upstream service not available")
+			err = hc.NewHTTPError(http.StatusServiceUnavailable, "upstream service not available")
+		} else {
+			err = handleAcoustIDErrResp(resp.StatusCode, b)
 		}
-		return nil, handleAcoustIDErrResp(resp)
-	}
 
-	var lookupResp AcoustIDLookupResp
-	breader := bytes.NewReader(b)
-	err = json.NewDecoder(breader).Decode(&lookupResp)
-	if err != nil {
-		return nil, err
+		retryable := isRejectedStatus(resp.StatusCode) || idempotent && isRetryableStatus(resp.StatusCode)
+		return retryAfter(resp, time.Now()), retryable, err
 	}
 
-	return &lookupResp, nil
+	return 0, false, json.NewDecoder(bytes.NewReader(b)).Decode(v)
 }
 
-func retryAfterSec(r *http.Response) time.Duration {
-	retryAfterH := r.Header.Get("Retry-After")
-	retryAfterSec, err := strconv.Atoi(retryAfterH)
-	if err != nil {
-		return AcoustIDReqDelay
+// clientQueryVals returns the query values identifying the application
+func (a *AcoustID) clientQueryVals() url.Values {
+	values := url.Values{}
+	values.Set("client", a.apiKey)
+	if a.clientVersion != "" {
+		values.Set("clientversion", a.clientVersion)
 	}
 
-	return time.Duration(retryAfterSec) * time.Second
+	return values
 }
 
 func (a *AcoustID) buildLookupQueryVals(f *fp.Fingerprint) url.Values {
-	values := url.Values{}
-	values.Set("client", a.apiKey)
+	values := a.clientQueryVals()
 	values.Add("meta", strings.Join(lookupMeta, " "))
 	values.Add("duration", strconv.Itoa(int(f.Duration)))
 	values.Add("fingerprint", f.Value)
@@ -97,27 +244,46 @@ func (a *AcoustID) buildLookupQueryVals(f *fp.Fingerprint) url.Values {
 	return values
 }
 
-func (a *AcoustID) doHTTPRequest(f *fp.Fingerprint) (*http.Response, error) {
-	encodedPayload := a.buildLookupQueryVals(f).Encode()
-	req, err := http.NewRequest("POST", AcoustIDBaseURL, strings.NewReader(encodedPayload))
+// buildBatchLookupQueryVals returns the query values of a lookup of many
+// fingerprints, which are indexed by their position in fingerprints
+func (a *AcoustID) buildBatchLookupQueryVals(fingerprints []*fp.Fingerprint) url.Values {
+	values := a.clientQueryVals()
+	values.Add("meta", strings.Join(lookupMeta, " "))
+	for i, f := range fingerprints {
+		values.Add("duration."+strconv.Itoa(i), strconv.Itoa(int(f.Duration)))
+		values.Add("fingerprint."+strconv.Itoa(i), f.Value)
+	}
+
+	return values
+}
+
+func (a *AcoustID) doHTTPRequest(ctx context.Context, path string, values url.Values) (*http.Response, error) {
+	if err := a.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", a.endpoint+path, strings.NewReader(values.Encode()))
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if a.userAgent != "" {
+		req.Header.Set("User-Agent", a.userAgent)
+	}
 
-	httpClient := hc.NewClient()
-
-	return httpClient.Do(req)
+	return a.httpClient.Do(req)
 }
 
-func handleAcoustIDErrResp(resp *http.Response) error {
+func handleAcoustIDErrResp(statusCode int, body []byte) error {
 	var errResp AcoustErrResp
-	err := json.NewDecoder(resp.Body).Decode(&errResp)
-	if err != nil {
-		return err
+	err := json.Unmarshal(body, &errResp)
+	if err != nil || errResp.Error.Message == "" {
+		// proxies in front of the API answer with their own error pages
+		return hc.NewHTTPError(statusCode, http.StatusText(statusCode))
 	}
 
-	return hc.NewHTTPError(resp.StatusCode, errResp.Error.Message)
+	return hc.NewHTTPError(statusCode, errResp.Error.Message)
 }
 
 // ACResultsByScore is the ACLookupResult implementation of the sort.Interface
@@ -1,6 +1,8 @@
 package acoustid
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"testing"
@@ -32,7 +34,7 @@ func TestLookupFingerprintOK(t *testing.T) {
 		Duration: 100,
 		Value:    "the-extracted-fingerprint",
 	}
-	got, err := acClient.LookupFingerprint(&fingerprint, false)
+	got, err := acClient.LookupFingerprint(&fingerprint)
 	assert.NoError(t, err)
 	assert.Equal(t, &AcoustIDLookupResp{
 		Status: "ok",
@@ -83,7 +85,7 @@ func TestLookupFingerprintStatusNotOK(t *testing.T) {
 		Duration: 100,
 		Value:    "the-extracted-fingerprint",
 	}
-	_, err = acClient.LookupFingerprint(&fingerprint, false)
+	_, err = acClient.LookupFingerprint(&fingerprint)
 	assert.Equal(t, hc.HTTPError{
 		Code:    http.StatusBadRequest,
 		Message: "invalid fingerprint",
@@ -101,15 +103,176 @@ func TestLookupFingerprintStatusServiceUnavailable(t *testing.T) {
 		},
 	)
 
-	acClient := NewAcoustID("secret-key")
+	acClient := NewAcoustID("secret-key", WithRetryPolicy(RetryPolicy{MaxAttempts: 2}))
 	fingerprint := fp.Fingerprint{
 		Duration: 100,
 		Value:    "the-extracted-fingerprint",
 	}
-	_, err := acClient.LookupFingerprint(&fingerprint, true)
+	_, err := acClient.LookupFingerprint(&fingerprint)
 	assert.Equal(t, hc.HTTPError{
 		Code:    http.StatusServiceUnavailable,
 		Message: "upstream service not available",
 	}, err)
 	assert.Equal(t, 2, httpmock.GetTotalCallCount())
 }
+
+func TestLookupFingerprintsOK(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	testDataFilepath := "../../test/data/acoustid_batch_response.json"
+	data, err := ioutil.ReadFile(testDataFilepath)
+	assert.NoError(t, err)
+
+	httpmock.RegisterResponder("POST", AcoustIDBaseURL,
+		func(req *http.Request) (*http.Response, error) {
+			assert.NoError(t, req.ParseForm())
+			assert.Equal(t, "secret-key", req.PostForm.Get("client"))
+			assert.Equal(t, "100", req.PostForm.Get("duration.0"))
+			assert.Equal(t, "fingerprint-1", req.PostForm.Get("fingerprint.1"))
+			assert.Equal(t, "fingerprint-2", req.PostForm.Get("fingerprint.2"))
+			assert.Empty(t, req.PostForm.Get("fingerprint"))
+
+			return httpmock.NewBytesResponse(http.StatusOK, data), nil
+		},
+	)
+
+	fingerprints := []*fp.Fingerprint{
+		{Duration: 100, Value: "fingerprint-0"},
+		{Duration: 200, Value: "fingerprint-1"},
+		{Duration: 300, Value: "fingerprint-2"},
+	}
+
+	acClient := NewAcoustID("secret-key")
+	got, err := acClient.LookupFingerprints(context.Background(), fingerprints)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, httpmock.GetTotalCallCount())
+	assert.Equal(t, []BatchLookupResult{
+		{Fingerprint: fingerprints[0], Results: []ACLookupResult{}},
+		{Fingerprint: fingerprints[1], Results: []ACLookupResult{
+			{ID: "4e0d8649-1f89-44f3-91af-4c0dbee81f28", Score: 0.42},
+		}},
+		{Fingerprint: fingerprints[2], Results: []ACLookupResult{
+			{
+				ID:         "033908fc-19da-4afa-a8a8-f8e1b87ada75",
+				Score:      0.995636,
+				Recordings: []Recording{{MBRecordingID: "d4d24fa2-22f5-4b02-8751-8c0cf9cd02b2"}},
+			},
+		}},
+	}, got)
+}
+
+func TestLookupFingerprintsSplitsBatches(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var batchSizes []int
+	httpmock.RegisterResponder("POST", AcoustIDBaseURL,
+		func(req *http.Request) (*http.Response, error) {
+			assert.NoError(t, req.ParseForm())
+
+			size := 0
+			for req.PostForm.Get(fmt.Sprintf("fingerprint.%d", size)) != "" {
+				size++
+			}
+			batchSizes = append(batchSizes, size)
+
+			return httpmock.NewStringResponse(http.StatusOK, `{"status": "ok", "fingerprints": [{"index": "0", "results": [{"id": "the-id"}]}]}`), nil
+		},
+	)
+
+	fingerprints := make([]*fp.Fingerprint, LookupBatchSize+1)
+	for i := range fingerprints {
+		fingerprints[i] = &fp.Fingerprint{Duration: 100, Value: fmt.Sprintf("fingerprint-%d", i)}
+	}
+
+	acClient := NewAcoustID("secret-key")
+	got, err := acClient.LookupFingerprints(context.Background(), fingerprints)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{LookupBatchSize, 1}, batchSizes)
+	assert.Len(t, got, len(fingerprints))
+	assert.Equal(t, "the-id", got[0].Results[0].ID)
+	assert.Empty(t, got[1].Results)
+	assert.Equal(t, fingerprints[LookupBatchSize], got[LookupBatchSize].Fingerprint)
+	assert.Equal(t, "the-id", got[LookupBatchSize].Results[0].ID)
+}
+
+func TestLookupFingerprintsPartialFailure(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	responses := []*http.Response{
+		httpmock.NewStringResponse(http.StatusOK, `{"status": "ok", "fingerprints": [{"index": "0", "results": [{"id": "the-id"}]}]}`),
+		httpmock.NewStringResponse(http.StatusBadRequest, `{"status": "error", "error": {"code": 3, "message": "invalid fingerprint"}}`),
+	}
+	httpmock.RegisterResponder("POST", AcoustIDBaseURL,
+		func(req *http.Request) (*http.Response, error) {
+			resp := responses[0]
+			responses = responses[1:]
+			return resp, nil
+		},
+	)
+
+	fingerprints := make([]*fp.Fingerprint, LookupBatchSize+1)
+	for i := range fingerprints {
+		fingerprints[i] = &fp.Fingerprint{Duration: 100, Value: fmt.Sprintf("fingerprint-%d", i)}
+	}
+
+	// the results of the first batch are kept and the fingerprints of the failed
+	// batch are reported as failed
+	var batches [][]BatchLookupResult
+	acClient := NewAcoustID("secret-key")
+	got, err := acClient.LookupFingerprintsFunc(context.Background(), fingerprints, func(batch []BatchLookupResult) {
+		batches = append(batches, batch)
+	})
+	assert.NoError(t, err)
+	assert.Len(t, got, len(fingerprints))
+	assert.Equal(t, "the-id", got[0].Results[0].ID)
+	assert.NoError(t, got[LookupBatchSize-1].Err)
+	assert.Equal(t, fingerprints[LookupBatchSize], got[LookupBatchSize].Fingerprint)
+	assert.Equal(t, hc.NewHTTPError(http.StatusBadRequest, "invalid fingerprint"), got[LookupBatchSize].Err)
+
+	// each batch is reported as soon as it completes
+	assert.Len(t, batches, 2)
+	assert.Len(t, batches[0], LookupBatchSize)
+	assert.Equal(t, got[LookupBatchSize:], batches[1])
+}
+
+func TestLookupFingerprintsCancelled(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	httpmock.RegisterResponder("POST", AcoustIDBaseURL,
+		func(req *http.Request) (*http.Response, error) {
+			cancel()
+			return httpmock.NewStringResponse(http.StatusOK, `{"status": "ok", "fingerprints": []}`), nil
+		},
+	)
+
+	fingerprints := make([]*fp.Fingerprint, LookupBatchSize+1)
+	for i := range fingerprints {
+		fingerprints[i] = &fp.Fingerprint{Duration: 100, Value: fmt.Sprintf("fingerprint-%d", i)}
+	}
+
+	// the completed batches are returned with the ctx error
+	got, err := NewAcoustID("secret-key").LookupFingerprints(ctx, fingerprints)
+	assert.Equal(t, context.Canceled, err)
+	assert.Len(t, got, LookupBatchSize)
+}
+
+func TestLookupFingerprintsInvalidIndex(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", AcoustIDBaseURL,
+		httpmock.NewStringResponder(http.StatusOK, `{"status": "ok", "fingerprints": [{"index": "1", "results": []}]}`),
+	)
+
+	acClient := NewAcoustID("secret-key")
+	got, err := acClient.LookupFingerprints(context.Background(), []*fp.Fingerprint{{Duration: 100, Value: "fingerprint-0"}})
+	assert.NoError(t, err)
+	assert.Len(t, got, 1)
+	assert.Error(t, got[0].Err)
+	assert.Empty(t, got[0].Results)
+}
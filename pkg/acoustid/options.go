@@ -0,0 +1,139 @@
+package acoustid
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	hc "github.com/ocramh/fingerprinter/internal/httpclient"
+	"github.com/ocramh/fingerprinter/internal/ratelimit"
+)
+
+// Option configures optional AcoustID settings
+type Option func(*clientConfig)
+
+// clientConfig collects the options before the HTTP client is built, so that
+// their order doesn't matter and a client passed to WithHTTPClient is never
+// modified
+type clientConfig struct {
+	endpoint   string
+	httpClient *http.Client
+	transport  http.RoundTripper
+	timeout    time.Duration
+	userAgent  string
+
+	rateRequests int
+	ratePer      time.Duration
+	rateLockFile string
+
+	retry RetryPolicy
+
+	clientVersion string
+	pollInterval  time.Duration
+}
+
+// WithEndpoint sets the root URL of the AcoustID API, DefaultEndpoint by
+// default. It allows to query a self-hosted acoustid-server, e.g.
+// http://localhost:5000/v2
+func WithEndpoint(endpoint string) Option {
+	return func(c *clientConfig) {
+		c.endpoint = strings.TrimSuffix(endpoint, "/")
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to query the API. WithTransport and
+// WithTimeout apply to a copy of client
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *clientConfig) {
+		c.httpClient = client
+	}
+}
+
+// WithTransport sets the RoundTripper of the HTTP client used to query the API
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *clientConfig) {
+		c.transport = transport
+	}
+}
+
+// WithTimeout sets the timeout of each HTTP request, hc.ReqTimeout by default
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *clientConfig) {
+		c.timeout = timeout
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with each request
+func WithUserAgent(userAgent string) Option {
+	return func(c *clientConfig) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithRateLimit sets the number of requests sent per period, DefaultRateLimit per
+// second by default. Requests exceeding it wait for their turn
+func WithRateLimit(requests int, per time.Duration) Option {
+	return func(c *clientConfig) {
+		c.rateRequests = requests
+		c.ratePer = per
+	}
+}
+
+// WithRateLimitLockFile shares the rate limit with the other processes of the
+// host using the same lock file
+func WithRateLimitLockFile(path string) Option {
+	return func(c *clientConfig) {
+		c.rateLockFile = path
+	}
+}
+
+// WithRetryPolicy sets how the failed requests are retried, DefaultRetryPolicy
+// by default. Use NoRetry to disable retries. The unset fields of policy are
+// filled as described by RetryPolicy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *clientConfig) {
+		c.retry = policy.withDefaults()
+	}
+}
+
+// WithClientVersion sets the application version sent with each request
+func WithClientVersion(version string) Option {
+	return func(c *clientConfig) {
+		c.clientVersion = version
+	}
+}
+
+// WithPollInterval sets the interval between two checks of the status of the
+// pending submissions, DefaultPollInterval by default
+func WithPollInterval(interval time.Duration) Option {
+	return func(c *clientConfig) {
+		c.pollInterval = interval
+	}
+}
+
+// limiter returns the rate limiter built from the options
+func (c clientConfig) limiter() *ratelimit.Limiter {
+	if c.rateLockFile != "" {
+		return ratelimit.NewShared(c.rateRequests, c.ratePer, c.rateLockFile)
+	}
+
+	return ratelimit.New(c.rateRequests, c.ratePer)
+}
+
+// client returns the HTTP client built from the options
+func (c clientConfig) client() *http.Client {
+	client := hc.NewClient()
+	if c.httpClient != nil {
+		clientCopy := *c.httpClient
+		client = &clientCopy
+	}
+
+	if c.transport != nil {
+		client.Transport = c.transport
+	}
+	if c.timeout > 0 {
+		client.Timeout = c.timeout
+	}
+
+	return client
+}
@@ -0,0 +1,100 @@
+package acoustid
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestWithEndpoint(t *testing.T) {
+	data, err := ioutil.ReadFile("../../test/data/acoustid_response.json")
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/v2/lookup", r.URL.Path)
+		assert.Equal(t, "fingerprinter/1.0.0", r.Header.Get("User-Agent"))
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "secret-key", r.PostForm.Get("client"))
+		assert.Equal(t, "100", r.PostForm.Get("duration"))
+		assert.Equal(t, "the-extracted-fingerprint", r.PostForm.Get("fingerprint"))
+
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	acClient := NewAcoustID("secret-key",
+		WithEndpoint(server.URL+"/v2/"),
+		WithUserAgent("fingerprinter/1.0.0"),
+	)
+	got, err := acClient.LookupFingerprint(&fp.Fingerprint{Duration: 100, Value: "the-extracted-fingerprint"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", got.Status)
+	assert.Equal(t, "033908fc-19da-4afa-a8a8-f8e1b87ada75", got.Results[0].ID)
+}
+
+func TestWithTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	acClient := NewAcoustID("secret-key", WithEndpoint(server.URL), WithTimeout(50*time.Millisecond), WithRetryPolicy(NoRetry))
+	_, err := acClient.LookupFingerprint(&fp.Fingerprint{Duration: 100, Value: "the-extracted-fingerprint"})
+	assert.Error(t, err)
+}
+
+func TestWithHTTPClientAndTransport(t *testing.T) {
+	var requested []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.String())
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"status": "ok", "results": []}`)),
+			Header:     http.Header{},
+		}, nil
+	})
+
+	httpClient := &http.Client{Timeout: time.Minute}
+	acClient := NewAcoustID("secret-key", WithTransport(transport), WithHTTPClient(httpClient))
+	got, err := acClient.LookupFingerprint(&fp.Fingerprint{Duration: 100, Value: "the-extracted-fingerprint"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", got.Status)
+	assert.Equal(t, []string{AcoustIDBaseURL}, requested)
+
+	// the client passed to the option is left untouched
+	assert.Nil(t, httpClient.Transport)
+	assert.Equal(t, time.Minute, acClient.httpClient.Timeout)
+}
+
+func TestWithRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "ok", "results": []}`))
+	}))
+	defer server.Close()
+
+	acClient := NewAcoustID("secret-key", WithEndpoint(server.URL), WithRateLimit(1, 100*time.Millisecond))
+	fingerprint := &fp.Fingerprint{Duration: 100, Value: "the-extracted-fingerprint"}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := acClient.LookupFingerprint(fingerprint)
+		assert.NoError(t, err)
+	}
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+}
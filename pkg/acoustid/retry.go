@@ -0,0 +1,168 @@
+package acoustid
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how the failed AcoustID requests are retried. Requests
+// are retried on 429, 502, 503 and 504 responses, on connection resets and on
+// timeouts. The delay between attempts grows exponentially from InitialBackoff
+// up to MaxBackoff, unless the response sets a longer Retry-After. The unset
+// backoff fields take the value of DefaultRetryPolicy, and so do both limits
+// when neither MaxAttempts nor MaxElapsedTime is set
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a request, retries
+	// included. 0 means no limit other than MaxElapsedTime
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts, Retry-After excluded
+	MaxBackoff time.Duration
+	// Multiplier scales the delay after each attempt
+	Multiplier float64
+	// Jitter randomises each delay by up to this fraction of it, e.g. 0.2 for ±20%
+	Jitter float64
+	// MaxElapsedTime is the time after which a request isn't retried anymore,
+	// measured from its first attempt. 0 means no limit
+	MaxElapsedTime time.Duration
+}
+
+var (
+	// DefaultRetryPolicy is the retry policy of the AcoustID clients
+	DefaultRetryPolicy = RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		MaxElapsedTime: 2 * time.Minute,
+	}
+
+	// NoRetry is the RetryPolicy that never retries a request
+	NoRetry = RetryPolicy{MaxAttempts: 1}
+)
+
+// withDefaults returns p with its unset fields filled from DefaultRetryPolicy,
+// so that requests are never retried without a delay nor forever
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if p.Multiplier <= 0 {
+		p.Multiplier = DefaultRetryPolicy.Multiplier
+	}
+	if p.MaxAttempts <= 0 && p.MaxElapsedTime <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+		p.MaxElapsedTime = DefaultRetryPolicy.MaxElapsedTime
+	}
+
+	return p
+}
+
+// backoff returns the delay before the retry following attempt, counted from 1
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(delay)
+}
+
+// next returns the delay before retrying a request that failed after attempt
+// and elapsed, and whether the request can be retried at all. retryAfter is the
+// delay asked by the server, 0 if none
+func (p RetryPolicy) next(attempt int, elapsed, retryAfter time.Duration) (time.Duration, bool) {
+	if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	delay := p.backoff(attempt)
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+
+	if p.MaxElapsedTime > 0 && elapsed+delay > p.MaxElapsedTime {
+		return 0, false
+	}
+
+	return delay, true
+}
+
+// isRetryableStatus reports whether a response status is worth retrying
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// isRejectedStatus reports whether a response status code means that the server
+// rejected the request without processing it, so that even the requests that
+// aren't idempotent can be retried
+func isRejectedStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable
+}
+
+// isRetryableErr reports whether the error of a request sent with ctx is
+// transient: a connection reset or closed by the server, or a timeout of the
+// HTTP client. The request isn't retried once ctx is done
+func isRetryableErr(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryAfter parses the Retry-After header of r, in seconds or as an HTTP date.
+// It returns 0 when the header is missing or invalid
+func retryAfter(r *http.Response, now time.Time) time.Duration {
+	header := strings.TrimSpace(r.Header.Get("Retry-After"))
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	date, err := http.ParseTime(header)
+	if err != nil || !date.After(now) {
+		return 0
+	}
+
+	return date.Sub(now)
+}
@@ -0,0 +1,208 @@
+package acoustid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	hc "github.com/ocramh/fingerprinter/internal/httpclient"
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     50 * time.Millisecond,
+	Multiplier:     2,
+	MaxElapsedTime: 5 * time.Second,
+}
+
+// newFlakyServer returns a server failing the first requests with the given
+// handlers and answering with an empty lookup response afterwards
+func newFlakyServer(t *testing.T, failures ...http.HandlerFunc) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(atomic.AddInt32(&calls, 1))
+		if call <= len(failures) {
+			failures[call-1](w, r)
+			return
+		}
+
+		w.Write([]byte(`{"status": "ok", "results": []}`))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+func respondWith(status int, retryAfter string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+	}
+}
+
+func resetConnection(w http.ResponseWriter, r *http.Request) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		panic(err)
+	}
+	conn.Close()
+}
+
+func lookupWithPolicy(serverURL string, policy RetryPolicy, opts ...Option) error {
+	opts = append(opts, WithEndpoint(serverURL), WithRetryPolicy(policy), WithRateLimit(1000, time.Second))
+	acClient := NewAcoustID("secret-key", opts...)
+	_, err := acClient.LookupFingerprint(&fp.Fingerprint{Duration: 100, Value: "the-extracted-fingerprint"})
+
+	return err
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	server, calls := newFlakyServer(t,
+		respondWith(http.StatusTooManyRequests, ""),
+		respondWith(http.StatusBadGateway, ""),
+		respondWith(http.StatusServiceUnavailable, ""),
+		respondWith(http.StatusGatewayTimeout, ""),
+		resetConnection,
+	)
+
+	policy := testRetryPolicy
+	policy.MaxAttempts = 6
+	assert.NoError(t, lookupWithPolicy(server.URL, policy))
+	assert.Equal(t, int32(6), atomic.LoadInt32(calls))
+}
+
+func TestRetryTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	server, calls := newFlakyServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	})
+
+	assert.NoError(t, lookupWithPolicy(server.URL, testRetryPolicy, WithTimeout(50*time.Millisecond)))
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	server, calls := newFlakyServer(t,
+		respondWith(http.StatusBadGateway, ""),
+		respondWith(http.StatusBadGateway, ""),
+		respondWith(http.StatusBadGateway, ""),
+	)
+
+	err := lookupWithPolicy(server.URL, testRetryPolicy)
+	assert.Equal(t, hc.NewHTTPError(http.StatusBadGateway, "Bad Gateway"), err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	server, calls := newFlakyServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status": "error", "error": {"code": 3, "message": "invalid fingerprint"}}`))
+	})
+
+	err := lookupWithPolicy(server.URL, testRetryPolicy)
+	assert.Equal(t, hc.NewHTTPError(http.StatusBadRequest, "invalid fingerprint"), err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	server, calls := newFlakyServer(t, respondWith(http.StatusTooManyRequests, "1"))
+
+	start := time.Now()
+	assert.NoError(t, lookupWithPolicy(server.URL, testRetryPolicy))
+	assert.True(t, time.Since(start) >= time.Second)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestRetryAfterExceedsMaxElapsedTime(t *testing.T) {
+	server, calls := newFlakyServer(t, respondWith(http.StatusServiceUnavailable, "3600"))
+
+	start := time.Now()
+	err := lookupWithPolicy(server.URL, testRetryPolicy)
+	assert.Equal(t, hc.NewHTTPError(http.StatusServiceUnavailable, "upstream service not available"), err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-1", 0},
+		{"Mon, 01 Mar 2021 12:00:30 GMT", 30 * time.Second},
+		{"Mon, 01 Mar 2021 11:00:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set("Retry-After", tt.header)
+		assert.Equal(t, tt.want, retryAfter(resp, now), tt.header)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	assert.Equal(t, 100*time.Millisecond, policy.backoff(1))
+	assert.Equal(t, 400*time.Millisecond, policy.backoff(3))
+	assert.Equal(t, time.Second, policy.backoff(10))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := policy.backoff(1)
+		assert.True(t, delay >= 50*time.Millisecond && delay <= 150*time.Millisecond, "delay %s", delay)
+	}
+}
+
+func TestRetryPolicyDefaults(t *testing.T) {
+	// a policy without limits gets the default ones
+	assert.Equal(t, RetryPolicy{
+		MaxAttempts:    DefaultRetryPolicy.MaxAttempts,
+		InitialBackoff: DefaultRetryPolicy.InitialBackoff,
+		MaxBackoff:     DefaultRetryPolicy.MaxBackoff,
+		Multiplier:     DefaultRetryPolicy.Multiplier,
+		MaxElapsedTime: DefaultRetryPolicy.MaxElapsedTime,
+	}, RetryPolicy{}.withDefaults())
+
+	// a single limit is kept, with the default backoff
+	assert.Equal(t, RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: DefaultRetryPolicy.InitialBackoff,
+		MaxBackoff:     DefaultRetryPolicy.MaxBackoff,
+		Multiplier:     DefaultRetryPolicy.Multiplier,
+	}, RetryPolicy{MaxAttempts: 2}.withDefaults())
+
+	policy := RetryPolicy{InitialBackoff: time.Millisecond, MaxElapsedTime: time.Second}.withDefaults()
+	assert.Equal(t, 0, policy.MaxAttempts)
+	assert.Equal(t, time.Second, policy.MaxElapsedTime)
+	assert.Equal(t, time.Millisecond, policy.InitialBackoff)
+
+	assert.Equal(t, 1, NoRetry.withDefaults().MaxAttempts)
+}
+
+func TestRetryZeroPolicy(t *testing.T) {
+	acClient := NewAcoustID("secret-key", WithRetryPolicy(RetryPolicy{}))
+	assert.Equal(t, DefaultRetryPolicy.MaxAttempts, acClient.retry.MaxAttempts)
+
+	// requests are never retried right away
+	delay, ok := acClient.retry.next(1, 0, 0)
+	assert.True(t, ok)
+	assert.True(t, delay > 0, "delay %s", delay)
+
+	_, ok = acClient.retry.next(DefaultRetryPolicy.MaxAttempts, 0, 0)
+	assert.False(t, ok)
+}
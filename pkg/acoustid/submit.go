@@ -0,0 +1,240 @@
+package acoustid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+)
+
+const (
+	submitPath           = "/submit"
+	submissionStatusPath = "/submission_status"
+
+	// SubmitBatchSize is the maximum number of fingerprints submitted with a
+	// single request
+	SubmitBatchSize = 20
+
+	// DefaultPollInterval is the interval between two checks of the status of
+	// pending submissions
+	DefaultPollInterval = 5 * time.Second
+
+	// SubmissionPending is the status of a submission not processed yet
+	SubmissionPending = "pending"
+	// SubmissionImported is the status of a submission added to the database
+	SubmissionImported = "imported"
+)
+
+var (
+	// ErrMissingUserKey is returned when submitting without an AcoustID user API key
+	ErrMissingUserKey = errors.New("submitting fingerprints requires a user API key")
+	// ErrMissingSubmissionMeta is returned for a submission without a MusicBrainz
+	// recording ID nor a track title
+	ErrMissingSubmissionMeta = errors.New("submission requires a MusicBrainz recording ID or a track title")
+)
+
+// Submission is an audio fingerprint to add to the AcoustID database, along with
+// the MusicBrainz recording ID of the audio or its metadata
+type Submission struct {
+	Fingerprint *fp.Fingerprint
+
+	// MBID is the MusicBrainz recording ID of the audio
+	MBID string
+	// Track, Artist, Album, AlbumArtist, Year, TrackNo and DiscNo describe the
+	// audio when it has no MusicBrainz recording ID
+	Track       string
+	Artist      string
+	Album       string
+	AlbumArtist string
+	Year        int
+	TrackNo     int
+	DiscNo      int
+
+	// Bitrate and FileFormat describe the audio file, they are optional
+	Bitrate    int
+	FileFormat string
+}
+
+// SubmissionResult is the outcome of a Submission. AcoustID is the AcoustID
+// track ID the fingerprint was imported as
+type SubmissionResult struct {
+	Submission *Submission `json:"-"`
+	ID         int64       `json:"id"`
+	Status     string      `json:"status"`
+	AcoustID   string      `json:"acoustid,omitempty"`
+}
+
+// submitResp is the type used to parse the responses of the submit and the
+// submission status endpoints. Index is the position of the submission in a
+// submit request
+type submitResp struct {
+	Status      string `json:"status"`
+	Submissions []struct {
+		Index  json.Number `json:"index"`
+		ID     int64       `json:"id"`
+		Status string      `json:"status"`
+		Result struct {
+			ID string `json:"id"`
+		} `json:"result"`
+	} `json:"submissions"`
+}
+
+// Submit submits fingerprints to the AcoustID database on behalf of the user
+// owning userKey. Each request contains up to SubmitBatchSize submissions.
+// Submit then polls the status of the submissions until none is pending or ctx
+// is done. The results are returned in the same order as submissions, along with
+// the error that stopped the polling if any. When a request fails the results of
+// the submissions already accepted are returned with the error, so that they
+// aren't submitted again. Submit requests are only retried when AcoustID
+// rejected them, as a request failing after reaching the server may have been
+// processed
+func (a *AcoustID) Submit(ctx context.Context, userKey string, submissions []Submission) ([]SubmissionResult, error) {
+	if userKey == "" {
+		return nil, ErrMissingUserKey
+	}
+	for i, s := range submissions {
+		if s.Fingerprint == nil {
+			return nil, fmt.Errorf("submission %d has no fingerprint", i)
+		}
+		if s.MBID == "" && s.Track == "" {
+			return nil, fmt.Errorf("submission %d: %w", i, ErrMissingSubmissionMeta)
+		}
+	}
+
+	results := make([]SubmissionResult, 0, len(submissions))
+	for start := 0; start < len(submissions); start += SubmitBatchSize {
+		end := start + SubmitBatchSize
+		if end > len(submissions) {
+			end = len(submissions)
+		}
+
+		batch, err := a.submitBatch(ctx, userKey, submissions[start:end])
+		if err != nil {
+			return results, err
+		}
+
+		results = append(results, batch...)
+	}
+
+	return results, a.waitSubmissions(ctx, results)
+}
+
+// submitBatch submits up to SubmitBatchSize submissions with a single request
+func (a *AcoustID) submitBatch(ctx context.Context, userKey string, submissions []Submission) ([]SubmissionResult, error) {
+	var resp submitResp
+	if err := a.post(ctx, submitPath, a.buildSubmitQueryVals(userKey, submissions), &resp, false); err != nil {
+		return nil, err
+	}
+
+	results := make([]SubmissionResult, len(submissions))
+	for i := range submissions {
+		results[i].Submission = &submissions[i]
+	}
+
+	for _, submissionResp := range resp.Submissions {
+		i, err := submissionResp.Index.Int64()
+		if err != nil || i < 0 || int(i) >= len(submissions) {
+			return nil, fmt.Errorf("invalid submission index in submit response: %s", submissionResp.Index)
+		}
+
+		results[i].ID = submissionResp.ID
+		results[i].Status = submissionResp.Status
+		results[i].AcoustID = submissionResp.Result.ID
+	}
+
+	return results, nil
+}
+
+// waitSubmissions polls the status of the pending submissions of results and
+// updates them until none is pending
+func (a *AcoustID) waitSubmissions(ctx context.Context, results []SubmissionResult) error {
+	for {
+		pending := make(map[int64]*SubmissionResult)
+		for i := range results {
+			if results[i].Status == SubmissionPending {
+				pending[results[i].ID] = &results[i]
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(a.pollInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		var resp submitResp
+		if err := a.post(ctx, submissionStatusPath, a.buildSubmissionStatusQueryVals(pending), &resp, true); err != nil {
+			return err
+		}
+
+		for _, submissionResp := range resp.Submissions {
+			result, ok := pending[submissionResp.ID]
+			if !ok {
+				continue
+			}
+
+			result.Status = submissionResp.Status
+			result.AcoustID = submissionResp.Result.ID
+		}
+	}
+}
+
+// buildSubmitQueryVals returns the query values of a submit request, where the
+// submissions are indexed by their position in submissions
+func (a *AcoustID) buildSubmitQueryVals(userKey string, submissions []Submission) url.Values {
+	values := a.clientQueryVals()
+	values.Set("user", userKey)
+	values.Set("wait", "1")
+
+	for i, s := range submissions {
+		suffix := "." + strconv.Itoa(i)
+		values.Set("duration"+suffix, strconv.Itoa(int(s.Fingerprint.Duration)))
+		values.Set("fingerprint"+suffix, s.Fingerprint.Value)
+
+		setIfNotEmpty(values, "mbid"+suffix, s.MBID)
+		setIfNotEmpty(values, "track"+suffix, s.Track)
+		setIfNotEmpty(values, "artist"+suffix, s.Artist)
+		setIfNotEmpty(values, "album"+suffix, s.Album)
+		setIfNotEmpty(values, "albumartist"+suffix, s.AlbumArtist)
+		setIfNotEmpty(values, "fileformat"+suffix, s.FileFormat)
+		setIfPositive(values, "year"+suffix, s.Year)
+		setIfPositive(values, "trackno"+suffix, s.TrackNo)
+		setIfPositive(values, "discno"+suffix, s.DiscNo)
+		setIfPositive(values, "bitrate"+suffix, s.Bitrate)
+	}
+
+	return values
+}
+
+// buildSubmissionStatusQueryVals returns the query values of a request of the
+// status of the pending submissions
+func (a *AcoustID) buildSubmissionStatusQueryVals(pending map[int64]*SubmissionResult) url.Values {
+	values := a.clientQueryVals()
+	for id := range pending {
+		values.Add("id", strconv.FormatInt(id, 10))
+	}
+
+	return values
+}
+
+func setIfNotEmpty(values url.Values, key string, value string) {
+	if value != "" {
+		values.Set(key, value)
+	}
+}
+
+func setIfPositive(values url.Values, key string, value int) {
+	if value > 0 {
+		values.Set(key, strconv.Itoa(value))
+	}
+}
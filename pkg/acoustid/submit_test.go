@@ -0,0 +1,203 @@
+package acoustid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	hc "github.com/ocramh/fingerprinter/internal/httpclient"
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+)
+
+func newSubmitClient(serverURL string, opts ...Option) *AcoustID {
+	opts = append([]Option{
+		WithEndpoint(serverURL),
+		WithClientVersion("1.0.0"),
+		WithPollInterval(10 * time.Millisecond),
+		WithRetryPolicy(NoRetry),
+		WithRateLimit(1000, time.Second),
+	}, opts...)
+
+	return NewAcoustID("secret-key", opts...)
+}
+
+func TestSubmit(t *testing.T) {
+	var statusChecks int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/submit", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "secret-key", r.PostForm.Get("client"))
+		assert.Equal(t, "1.0.0", r.PostForm.Get("clientversion"))
+		assert.Equal(t, "user-key", r.PostForm.Get("user"))
+
+		assert.Equal(t, "100", r.PostForm.Get("duration.0"))
+		assert.Equal(t, "fingerprint-0", r.PostForm.Get("fingerprint.0"))
+		assert.Equal(t, "d4d24fa2-22f5-4b02-8751-8c0cf9cd02b2", r.PostForm.Get("mbid.0"))
+		assert.Empty(t, r.PostForm.Get("track.0"))
+
+		assert.Equal(t, "fingerprint-1", r.PostForm.Get("fingerprint.1"))
+		assert.Equal(t, "Ice Cream", r.PostForm.Get("track.1"))
+		assert.Equal(t, "Battles", r.PostForm.Get("artist.1"))
+		assert.Equal(t, "La Di Da Di", r.PostForm.Get("album.1"))
+		assert.Equal(t, "2015", r.PostForm.Get("year.1"))
+		assert.Empty(t, r.PostForm.Get("mbid.1"))
+
+		w.Write([]byte(`{"status": "ok", "submissions": [
+			{"index": "1", "id": 2, "status": "pending"},
+			{"index": "0", "id": 1, "status": "imported", "result": {"id": "033908fc-19da-4afa-a8a8-f8e1b87ada75"}}
+		]}`))
+	})
+	mux.HandleFunc("/submission_status", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, []string{"2"}, r.PostForm["id"])
+
+		statusChecks++
+		if statusChecks == 1 {
+			w.Write([]byte(`{"status": "ok", "submissions": [{"id": 2, "status": "pending"}]}`))
+			return
+		}
+		w.Write([]byte(`{"status": "ok", "submissions": [{"id": 2, "status": "imported", "result": {"id": "4e0d8649-1f89-44f3-91af-4c0dbee81f28"}}]}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	submissions := []Submission{
+		{
+			Fingerprint: &fp.Fingerprint{Duration: 100, Value: "fingerprint-0"},
+			MBID:        "d4d24fa2-22f5-4b02-8751-8c0cf9cd02b2",
+		},
+		{
+			Fingerprint: &fp.Fingerprint{Duration: 200, Value: "fingerprint-1"},
+			Track:       "Ice Cream",
+			Artist:      "Battles",
+			Album:       "La Di Da Di",
+			Year:        2015,
+		},
+	}
+
+	got, err := newSubmitClient(server.URL).Submit(context.Background(), "user-key", submissions)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, statusChecks)
+	assert.Equal(t, []SubmissionResult{
+		{Submission: &submissions[0], ID: 1, Status: SubmissionImported, AcoustID: "033908fc-19da-4afa-a8a8-f8e1b87ada75"},
+		{Submission: &submissions[1], ID: 2, Status: SubmissionImported, AcoustID: "4e0d8649-1f89-44f3-91af-4c0dbee81f28"},
+	}, got)
+}
+
+func TestSubmitPollingCancelled(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/submit", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "ok", "submissions": [{"index": "0", "id": 1, "status": "pending"}]}`))
+	})
+	mux.HandleFunc("/submission_status", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "ok", "submissions": [{"id": 1, "status": "pending"}]}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	submissions := []Submission{{Fingerprint: &fp.Fingerprint{Duration: 100, Value: "fingerprint-0"}, Track: "Ice Cream"}}
+	got, err := newSubmitClient(server.URL).Submit(ctx, "user-key", submissions)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, []SubmissionResult{{Submission: &submissions[0], ID: 1, Status: SubmissionPending}}, got)
+}
+
+func TestSubmitPartialFailure(t *testing.T) {
+	var calls int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/submit", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status": "error", "error": {"code": 3, "message": "invalid fingerprint"}}`))
+			return
+		}
+
+		resp := `{"status": "ok", "submissions": [`
+		for i := 0; i < SubmitBatchSize; i++ {
+			if i > 0 {
+				resp += ","
+			}
+			resp += fmt.Sprintf(`{"index": "%d", "id": %d, "status": "imported"}`, i, i+1)
+		}
+		w.Write([]byte(resp + "]}"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	submissions := make([]Submission, SubmitBatchSize+1)
+	for i := range submissions {
+		submissions[i] = Submission{Fingerprint: &fp.Fingerprint{Duration: 100, Value: fmt.Sprintf("fingerprint-%d", i)}, Track: "Ice Cream"}
+	}
+
+	// the submissions of the first batch were accepted
+	got, err := newSubmitClient(server.URL).Submit(context.Background(), "user-key", submissions)
+	assert.Equal(t, hc.NewHTTPError(http.StatusBadRequest, "invalid fingerprint"), err)
+	assert.Len(t, got, SubmitBatchSize)
+	assert.Equal(t, &submissions[SubmitBatchSize-1], got[SubmitBatchSize-1].Submission)
+	assert.Equal(t, int64(SubmitBatchSize), got[SubmitBatchSize-1].ID)
+}
+
+func TestSubmitRetries(t *testing.T) {
+	submissions := []Submission{{Fingerprint: &fp.Fingerprint{Duration: 100, Value: "fingerprint-0"}, Track: "Ice Cream"}}
+	accept := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "ok", "submissions": [{"index": "0", "id": 1, "status": "imported"}]}`))
+	}
+
+	testcases := []struct {
+		name    string
+		failure http.HandlerFunc
+		retried bool
+	}{
+		{name: "rate limited", failure: respondWith(http.StatusTooManyRequests, ""), retried: true},
+		{name: "unavailable", failure: respondWith(http.StatusServiceUnavailable, ""), retried: true},
+		// the server may have processed the submissions
+		{name: "bad gateway", failure: respondWith(http.StatusBadGateway, "")},
+		{name: "connection reset", failure: resetConnection},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					testcase.failure(w, r)
+					return
+				}
+				accept(w, r)
+			}))
+			defer server.Close()
+
+			_, err := newSubmitClient(server.URL, WithRetryPolicy(testRetryPolicy)).Submit(context.Background(), "user-key", submissions)
+			if testcase.retried {
+				assert.NoError(t, err)
+				assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+			} else {
+				assert.Error(t, err)
+				assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+			}
+		})
+	}
+}
+
+func TestSubmitInvalid(t *testing.T) {
+	acClient := NewAcoustID("secret-key")
+	fingerprint := &fp.Fingerprint{Duration: 100, Value: "fingerprint-0"}
+
+	_, err := acClient.Submit(context.Background(), "", []Submission{{Fingerprint: fingerprint, Track: "Ice Cream"}})
+	assert.Equal(t, ErrMissingUserKey, err)
+
+	_, err = acClient.Submit(context.Background(), "user-key", []Submission{{Fingerprint: fingerprint}})
+	assert.True(t, errors.Is(err, ErrMissingSubmissionMeta))
+
+	_, err = acClient.Submit(context.Background(), "user-key", []Submission{{MBID: "d4d24fa2-22f5-4b02-8751-8c0cf9cd02b2"}})
+	assert.Error(t, err)
+}
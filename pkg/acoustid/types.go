@@ -1,11 +1,37 @@
 package acoustid
 
+import (
+	"encoding/json"
+
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+)
+
 // AcoustIDLookupResp is the type used to parse a successfull AcoustID JSON response
 type AcoustIDLookupResp struct {
 	Status  string           `json:"status"`
 	Results []ACLookupResult `json:"results"`
 }
 
+// BatchLookupResult holds the matches of one of the fingerprints looked up by
+// AcoustID.LookupFingerprints. Err is set when the request looking up the
+// fingerprint failed
+type BatchLookupResult struct {
+	Fingerprint *fp.Fingerprint
+	Results     []ACLookupResult
+	Err         error
+}
+
+// batchLookupResp is the type used to parse the response to a lookup of many
+// fingerprints. Index is the position of the fingerprint in the request, which
+// the API encodes as a string
+type batchLookupResp struct {
+	Status       string `json:"status"`
+	Fingerprints []struct {
+		Index   json.Number      `json:"index"`
+		Results []ACLookupResult `json:"results"`
+	} `json:"fingerprints"`
+}
+
 // ACLookupResult is a fingerprint match. It contaons one or more recordings that
 // include the audio fingerprint analized and the accuracy score
 type ACLookupResult struct {
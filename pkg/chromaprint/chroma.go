@@ -0,0 +1,103 @@
+package chromaprint
+
+import "math"
+
+const numBands = 12
+
+var (
+	chromaFilterCoefficients = []float64{0.25, 0.75, 1.0, 0.75, 0.25}
+)
+
+// chroma maps a power spectrum onto the 12 semitones of the musical octave
+type chroma struct {
+	minIndex int
+	maxIndex int
+	notes    []int
+	features []float64
+}
+
+func newChroma(minFreq int, maxFreq int, frameSize int, sampleRate int) *chroma {
+	c := &chroma{
+		minIndex: freqToIndex(float64(minFreq), frameSize, sampleRate),
+		maxIndex: freqToIndex(float64(maxFreq), frameSize, sampleRate),
+		notes:    make([]int, frameSize),
+		features: make([]float64, numBands),
+	}
+
+	if c.minIndex < 1 {
+		c.minIndex = 1
+	}
+
+	if c.maxIndex > frameSize/2 {
+		c.maxIndex = frameSize / 2
+	}
+
+	for i := c.minIndex; i < c.maxIndex; i++ {
+		freq := float64(i) * float64(sampleRate) / float64(frameSize)
+		octave := math.Log(freq/(440.0/16.0)) / math.Log(2.0)
+		c.notes[i] = int(numBands * (octave - math.Floor(octave)))
+	}
+
+	return c
+}
+
+// calculate returns the energy of each chroma band. The returned slice is reused
+// by the next call
+func (c *chroma) calculate(spectrum []float64) []float64 {
+	for i := range c.features {
+		c.features[i] = 0
+	}
+
+	for i := c.minIndex; i < c.maxIndex; i++ {
+		c.features[c.notes[i]] += spectrum[i]
+	}
+
+	return c.features
+}
+
+func freqToIndex(freq float64, frameSize int, sampleRate int) int {
+	return int(math.Round(float64(frameSize) * freq / float64(sampleRate)))
+}
+
+// chromaFilter smooths chroma features over time with a FIR filter
+type chromaFilter struct {
+	coefficients []float64
+	buffer       [][]float64
+	// size counts the features buffered before the filter started its output
+	size   int
+	result []float64
+}
+
+func newChromaFilter(coefficients []float64) *chromaFilter {
+	return &chromaFilter{
+		coefficients: coefficients,
+		result:       make([]float64, numBands),
+	}
+}
+
+// apply adds features to the filter history and returns the filtered features.
+// ok is false until the filter has been filled. Like chromaprint's ChromaFilter,
+// the output starts with the features following the ones filling the filter
+func (c *chromaFilter) apply(features []float64) (filtered []float64, ok bool) {
+	row := make([]float64, len(features))
+	copy(row, features)
+
+	c.buffer = append(c.buffer, row)
+	if len(c.buffer) > len(c.coefficients) {
+		c.buffer = c.buffer[1:]
+	}
+
+	if c.size < len(c.coefficients) {
+		c.size++
+		return nil, false
+	}
+
+	for i := range c.result {
+		c.result[i] = 0
+		for j, coeff := range c.coefficients {
+			c.result[i] += c.buffer[j][i] * coeff
+		}
+	}
+
+	return c.result, true
+}
@@ -0,0 +1,185 @@
+// Package chromaprint is a pure Go implementation of the Chromaprint audio
+// fingerprinting algorithm. It follows the chromaprint C++ library step by step,
+// resampling included, to produce the same sub-fingerprints and compressed
+// fingerprint strings as fpcalc when fed with the same decoded PCM samples. The
+// fingerprint package checks it against fpcalc output recorded for the audio
+// files in test/data/audio
+package chromaprint
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	// SampleRate is the sample rate the fingerprinting pipeline operates at.
+	// Input audio is resampled to this rate before being analysed
+	SampleRate = 11025
+
+	// AlgorithmTest2 is chromaprint's default fingerprinting algorithm and the
+	// only one implemented by this package. fpcalc refers to it as algorithm 2
+	AlgorithmTest2 = 1
+
+	frameSize    = 4096
+	frameOverlap = frameSize - frameSize/3
+	frameStep    = frameSize - frameOverlap
+
+	minFreq = 28
+	maxFreq = 3520
+)
+
+var (
+	ErrInvalidSampleRate = errors.New("invalid sample rate")
+	ErrInvalidChannels   = errors.New("invalid number of channels")
+	ErrInvalidEncoding   = errors.New("invalid compressed fingerprint")
+)
+
+// ItemDuration is the audio duration, in seconds, covered by the step between two
+// consecutive sub-fingerprints
+const ItemDuration = float64(frameStep) / SampleRate
+
+// Fingerprinter calculates a raw chromaprint fingerprint from a stream of PCM
+// samples. Samples are pushed with Feed and the fingerprint is returned by
+// Finish. A Fingerprinter must not be used concurrently
+type Fingerprinter struct {
+	channels  int
+	resampler *resampler
+
+	// pcm holds the mono samples at SampleRate that have not been consumed by
+	// the FFT yet
+	pcm []int16
+
+	fft          *fft
+	window       []float64
+	chroma       *chroma
+	chromaFilter *chromaFilter
+	image        *integralImage
+	fingerprint  []uint32
+}
+
+// NewFingerprinter returns a Fingerprinter expecting interleaved 16 bit samples
+// with the given sample rate and number of channels
+func NewFingerprinter(sampleRate int, channels int) (*Fingerprinter, error) {
+	if sampleRate <= 0 {
+		return nil, ErrInvalidSampleRate
+	}
+
+	if channels <= 0 {
+		return nil, ErrInvalidChannels
+	}
+
+	f := &Fingerprinter{
+		channels:     channels,
+		fft:          newFFT(frameSize),
+		window:       hammingWindow(frameSize, 1.0/math.MaxInt16),
+		chroma:       newChroma(minFreq, maxFreq, frameSize, SampleRate),
+		chromaFilter: newChromaFilter(chromaFilterCoefficients),
+		image:        newIntegralImage(numBands),
+	}
+
+	if sampleRate != SampleRate {
+		f.resampler = newResampler(sampleRate, SampleRate)
+	}
+
+	return f, nil
+}
+
+// Feed pushes interleaved samples through the fingerprinting pipeline
+func (f *Fingerprinter) Feed(samples []int16) {
+	mono := downmix(samples, f.channels)
+	if f.resampler != nil {
+		mono = f.resampler.process(mono, false)
+	}
+
+	f.consume(mono)
+}
+
+// Finish flushes any buffered audio and returns the raw fingerprint calculated
+// from all the samples fed so far
+func (f *Fingerprinter) Finish() []uint32 {
+	if f.resampler != nil {
+		f.consume(f.resampler.process(nil, true))
+	}
+
+	return f.fingerprint
+}
+
+func (f *Fingerprinter) consume(samples []int16) {
+	f.pcm = append(f.pcm, samples...)
+
+	var offset int
+	for len(f.pcm)-offset >= frameSize {
+		spectrum := f.fft.powerSpectrum(f.pcm[offset:offset+frameSize], f.window)
+		f.consumeFeatures(f.chroma.calculate(spectrum))
+		offset += frameStep
+	}
+
+	f.pcm = append(f.pcm[:0], f.pcm[offset:]...)
+}
+
+func (f *Fingerprinter) consumeFeatures(features []float64) {
+	filtered, ok := f.chromaFilter.apply(features)
+	if !ok {
+		return
+	}
+
+	normalize(filtered, 0.01)
+	f.image.addRow(filtered)
+
+	if f.image.rows() >= maxClassifierWidth {
+		f.fingerprint = append(f.fingerprint, subFingerprint(f.image, f.image.rows()-maxClassifierWidth))
+	}
+}
+
+// Fingerprint is a convenience function returning the raw fingerprint of a
+// complete buffer of interleaved samples
+func Fingerprint(samples []int16, sampleRate int, channels int) ([]uint32, error) {
+	f, err := NewFingerprinter(sampleRate, channels)
+	if err != nil {
+		return nil, err
+	}
+
+	f.Feed(samples)
+
+	return f.Finish(), nil
+}
+
+// downmix converts interleaved samples to mono the same way chromaprint does,
+// by averaging the channels with integer arithmetic
+func downmix(samples []int16, channels int) []int16 {
+	if channels == 1 {
+		out := make([]int16, len(samples))
+		copy(out, samples)
+		return out
+	}
+
+	out := make([]int16, len(samples)/channels)
+	for i := range out {
+		var sum int
+		for ch := 0; ch < channels; ch++ {
+			sum += int(samples[i*channels+ch])
+		}
+		out[i] = int16(sum / channels)
+	}
+
+	return out
+}
+
+func normalize(v []float64, threshold float64) {
+	var sum float64
+	for _, x := range v {
+		sum += x * x
+	}
+
+	norm := math.Sqrt(sum)
+	if norm < threshold {
+		for i := range v {
+			v[i] = 0
+		}
+		return
+	}
+
+	for i := range v {
+		v[i] /= norm
+	}
+}
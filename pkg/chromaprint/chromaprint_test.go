@@ -0,0 +1,243 @@
+package chromaprint
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sineWave(seconds float64, sampleRate int, channels int, freqs ...float64) []int16 {
+	n := int(seconds * float64(sampleRate))
+	samples := make([]int16, 0, n*channels)
+	for i := 0; i < n; i++ {
+		var v float64
+		for j, f := range freqs {
+			// change the active note every second to produce a non trivial fingerprint
+			if (i/sampleRate)%len(freqs) == j {
+				v += math.Sin(2 * math.Pi * f * float64(i) / float64(sampleRate))
+			}
+		}
+
+		for ch := 0; ch < channels; ch++ {
+			samples = append(samples, int16(v*8000))
+		}
+	}
+
+	return samples
+}
+
+func TestFingerprintLength(t *testing.T) {
+	testcases := []struct {
+		name       string
+		numSamples int
+		expected   int
+	}{
+		{name: "shorter than a frame", numSamples: frameSize - 1, expected: 0},
+		{name: "not enough frames", numSamples: frameSize + 19*frameStep, expected: 0},
+		{name: "single sub-fingerprint", numSamples: frameSize + 20*frameStep, expected: 1},
+		{name: "ten seconds", numSamples: 10 * SampleRate, expected: 58},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			got, err := Fingerprint(make([]int16, testcase.numSamples), SampleRate, 1)
+			assert.NoError(t, err)
+			assert.Len(t, got, testcase.expected)
+		})
+	}
+}
+
+func TestFingerprintChannelsDownmix(t *testing.T) {
+	mono, err := Fingerprint(sineWave(10, SampleRate, 1, 440, 660, 880), SampleRate, 1)
+	assert.NoError(t, err)
+
+	stereo, err := Fingerprint(sineWave(10, SampleRate, 2, 440, 660, 880), SampleRate, 2)
+	assert.NoError(t, err)
+
+	assert.Equal(t, mono, stereo)
+}
+
+func TestFingerprintFeedInChunks(t *testing.T) {
+	samples := sineWave(10, 44100, 2, 440, 660, 880)
+
+	expected, err := Fingerprint(samples, 44100, 2)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, expected)
+
+	f, err := NewFingerprinter(44100, 2)
+	assert.NoError(t, err)
+	for i := 0; i < len(samples); i += 1000 {
+		end := i + 1000
+		if end > len(samples) {
+			end = len(samples)
+		}
+		f.Feed(samples[i:end])
+	}
+
+	assert.Equal(t, expected, f.Finish())
+}
+
+func TestFingerprintInvalidInput(t *testing.T) {
+	_, err := NewFingerprinter(0, 1)
+	assert.Equal(t, ErrInvalidSampleRate, err)
+
+	_, err = NewFingerprinter(SampleRate, 0)
+	assert.Equal(t, ErrInvalidChannels, err)
+}
+
+func TestResamplerKeepsConstantSignal(t *testing.T) {
+	in := make([]int16, 44100)
+	for i := range in {
+		in[i] = 1000
+	}
+
+	r := newResampler(44100, SampleRate)
+	out := append(r.process(in, false), r.process(nil, true)...)
+
+	// the last input samples that don't fill the filter are dropped
+	assert.True(t, len(out) <= SampleRate && len(out) > SampleRate-r.filterLength, "%d samples", len(out))
+	for _, s := range out {
+		assert.InDelta(t, 1000, s, 1)
+	}
+}
+
+func TestResamplerBuffering(t *testing.T) {
+	in := make([]int16, 3*resampleBufferSize+123)
+	for i := range in {
+		in[i] = int16(8000 * math.Sin(float64(i)/7))
+	}
+
+	whole := newResampler(48000, SampleRate)
+	expected := whole.process(in, true)
+
+	// feeding the input in chunks of any size gives the same output
+	chunked := newResampler(48000, SampleRate)
+	var got []int16
+	for start := 0; start < len(in); start += 1000 {
+		end := start + 1000
+		if end > len(in) {
+			end = len(in)
+		}
+		got = append(got, chunked.process(in[start:end], false)...)
+	}
+	got = append(got, chunked.process(nil, true)...)
+
+	assert.Equal(t, expected, got)
+}
+
+func TestResamplerFilterBank(t *testing.T) {
+	r := newResampler(44100, SampleRate)
+	assert.Equal(t, 80, r.filterLength)
+	// chromaprint resamples with 256 phases
+	assert.Equal(t, 255, r.phaseMask)
+	assert.Len(t, r.filterBank, 256*r.filterLength)
+
+	// each phase is normalised to the fixed point unit
+	for ph := 0; ph <= r.phaseMask; ph++ {
+		var sum int
+		for _, c := range r.filterBank[ph*r.filterLength : (ph+1)*r.filterLength] {
+			sum += int(c)
+		}
+		assert.InDelta(t, 1<<resampleFilterShift, sum, float64(r.filterLength))
+	}
+}
+
+func TestCompress(t *testing.T) {
+	testcases := []struct {
+		name     string
+		raw      []uint32
+		expected []byte
+	}{
+		{
+			name:     "empty fingerprint",
+			raw:      []uint32{},
+			expected: []byte{1, 0, 0, 0},
+		},
+		{
+			name: "normal bits only",
+			raw:  []uint32{1},
+			// deltas: 1, 0 packed as 3 bit values
+			expected: []byte{1, 0, 0, 1, 0x01},
+		},
+		{
+			name: "exceptional bits",
+			raw:  []uint32{1 << 10, 1 << 10},
+			// deltas: 7 (+4), 0, 0 followed by the exceptional value 4
+			expected: []byte{1, 0, 0, 2, 0x07, 0x00, 0x04},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			assert.Equal(t, testcase.expected, compress(testcase.raw, AlgorithmTest2))
+		})
+	}
+}
+
+func TestEncodeFingerprint(t *testing.T) {
+	assert.Equal(t, "AQAAAQE", EncodeFingerprint([]uint32{1}, AlgorithmTest2))
+}
+
+func TestDecodeFingerprint(t *testing.T) {
+	raw, algorithm, err := DecodeFingerprint("AQAAAQE")
+	assert.NoError(t, err)
+	assert.Equal(t, AlgorithmTest2, algorithm)
+	assert.Equal(t, []uint32{1}, raw)
+}
+
+func TestFingerprintRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	random := make([]uint32, 500)
+	for i := range random {
+		random[i] = rnd.Uint32()
+	}
+
+	testcases := []struct {
+		name string
+		raw  []uint32
+	}{
+		{name: "empty", raw: []uint32{}},
+		{name: "exceptional bits", raw: []uint32{1 << 10, 1 << 10, 1<<31 | 1, 0}},
+		{name: "random", raw: random},
+		{name: "audio", raw: mustFingerprint(t, sineWave(10, SampleRate, 1, 440, 660, 880))},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			raw, algorithm, err := DecodeFingerprint(EncodeFingerprint(testcase.raw, AlgorithmTest2))
+			assert.NoError(t, err)
+			assert.Equal(t, AlgorithmTest2, algorithm)
+			assert.Equal(t, testcase.raw, raw)
+		})
+	}
+}
+
+func TestDecodeInvalidFingerprint(t *testing.T) {
+	testcases := []struct {
+		name    string
+		encoded string
+	}{
+		{name: "invalid base64", encoded: "AQ$AAQE"},
+		{name: "short header", encoded: "AQAA"},
+		{name: "truncated values", encoded: "AQAAAg"},
+		{name: "missing exceptions", encoded: "AQAAAgcA"},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			_, _, err := DecodeFingerprint(testcase.encoded)
+			assert.Equal(t, ErrInvalidEncoding, err)
+		})
+	}
+}
+
+func mustFingerprint(t *testing.T, samples []int16) []uint32 {
+	raw, err := Fingerprint(samples, SampleRate, 1)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, raw)
+
+	return raw
+}
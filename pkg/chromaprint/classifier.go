@@ -0,0 +1,162 @@
+package chromaprint
+
+import "math"
+
+// filter is one of the six Haar-like filters chromaprint applies to the chroma
+// image. x is the time offset, y the first chroma band covered by the filter
+type filter struct {
+	kind   int
+	y      int
+	height int
+	width  int
+}
+
+// quantizer maps a filter response onto one of four levels
+type quantizer struct {
+	t0, t1, t2 float64
+}
+
+type classifier struct {
+	filter    filter
+	quantizer quantizer
+}
+
+// classifiersTest2 are the classifiers of chromaprint's default algorithm
+var classifiersTest2 = []classifier{
+	{filter{0, 4, 3, 15}, quantizer{1.98215, 2.35817, 2.63523}},
+	{filter{4, 4, 6, 15}, quantizer{-1.03809, -0.651211, -0.282167}},
+	{filter{1, 0, 4, 16}, quantizer{-0.298702, 0.119262, 0.558497}},
+	{filter{3, 8, 2, 12}, quantizer{-0.105439, 0.0153946, 0.135898}},
+	{filter{3, 4, 4, 8}, quantizer{-0.142891, 0.0258736, 0.200632}},
+	{filter{4, 0, 3, 5}, quantizer{-0.826319, -0.590612, -0.368214}},
+	{filter{1, 2, 2, 9}, quantizer{-0.557409, -0.233035, 0.0534525}},
+	{filter{2, 7, 3, 4}, quantizer{-0.0646826, 0.00620476, 0.0784847}},
+	{filter{2, 6, 2, 16}, quantizer{-0.192387, -0.029699, 0.215855}},
+	{filter{2, 1, 3, 2}, quantizer{-0.0397818, -0.00568076, 0.0292026}},
+	{filter{5, 10, 1, 15}, quantizer{-0.53823, -0.369934, -0.190235}},
+	{filter{3, 6, 2, 10}, quantizer{-0.124877, 0.0296483, 0.139239}},
+	{filter{2, 1, 1, 14}, quantizer{-0.101475, 0.0225617, 0.231971}},
+	{filter{3, 5, 6, 4}, quantizer{-0.0799915, -0.00729616, 0.063262}},
+	{filter{1, 9, 2, 12}, quantizer{-0.272556, 0.019424, 0.302559}},
+	{filter{3, 4, 2, 14}, quantizer{-0.164292, -0.0321188, 0.0846339}},
+}
+
+// maxClassifierWidth is the number of chroma frames needed to calculate a
+// single sub-fingerprint
+var maxClassifierWidth = func() int {
+	var max int
+	for _, c := range classifiersTest2 {
+		if c.filter.width > max {
+			max = c.filter.width
+		}
+	}
+	return max
+}()
+
+// subFingerprint calculates the 32 bit sub-fingerprint of the chroma frames
+// starting at offset
+func subFingerprint(img *integralImage, offset int) uint32 {
+	var bits uint32
+	for _, c := range classifiersTest2 {
+		bits = (bits << 2) | grayCode[c.quantizer.quantize(c.filter.apply(img, offset))]
+	}
+
+	return bits
+}
+
+var grayCode = [4]uint32{0, 1, 3, 2}
+
+func (q quantizer) quantize(v float64) int {
+	if v < q.t1 {
+		if v < q.t0 {
+			return 0
+		}
+		return 1
+	}
+
+	if v < q.t2 {
+		return 2
+	}
+	return 3
+}
+
+func (f filter) apply(img *integralImage, x int) float64 {
+	y, w, h := f.y, f.width, f.height
+
+	var a, b float64
+	switch f.kind {
+	case 0:
+		a = img.area(x, y, x+w, y+h)
+	case 1:
+		h2 := h / 2
+		a = img.area(x, y+h2, x+w, y+h)
+		b = img.area(x, y, x+w, y+h2)
+	case 2:
+		w2 := w / 2
+		a = img.area(x+w2, y, x+w, y+h)
+		b = img.area(x, y, x+w2, y+h)
+	case 3:
+		w2, h2 := w/2, h/2
+		a = img.area(x, y+h2, x+w2, y+h) + img.area(x+w2, y, x+w, y+h2)
+		b = img.area(x, y, x+w2, y+h2) + img.area(x+w2, y+h2, x+w, y+h)
+	case 4:
+		h3 := h / 3
+		a = img.area(x, y+h3, x+w, y+2*h3)
+		b = img.area(x, y, x+w, y+h3) + img.area(x, y+2*h3, x+w, y+h)
+	case 5:
+		w3 := w / 3
+		a = img.area(x+w3, y, x+2*w3, y+h)
+		b = img.area(x, y, x+w3, y+h) + img.area(x+2*w3, y, x+w, y+h)
+	}
+
+	return math.Log(1.0+a) - math.Log(1.0+b)
+}
+
+// integralImage is the summed-area table of the chroma frames, where rows are
+// frames and columns are chroma bands
+type integralImage struct {
+	columns int
+	data    [][]float64
+}
+
+func newIntegralImage(columns int) *integralImage {
+	return &integralImage{columns: columns}
+}
+
+func (i *integralImage) rows() int {
+	return len(i.data)
+}
+
+func (i *integralImage) addRow(row []float64) {
+	next := make([]float64, i.columns)
+
+	var sum float64
+	for c := 0; c < i.columns; c++ {
+		sum += row[c]
+		next[c] = sum
+	}
+
+	if n := len(i.data); n > 0 {
+		for c := range next {
+			next[c] += i.data[n-1][c]
+		}
+	}
+
+	i.data = append(i.data, next)
+}
+
+// area returns the sum of the cells in rows [r1, r2) and columns [c1, c2)
+func (i *integralImage) area(r1, c1, r2, c2 int) float64 {
+	if r1 == r2 || c1 == c2 {
+		return 0
+	}
+
+	at := func(r, c int) float64 {
+		if r < 0 || c < 0 {
+			return 0
+		}
+		return i.data[r][c]
+	}
+
+	return at(r2-1, c2-1) - at(r1-1, c2-1) - at(r2-1, c1-1) + at(r1-1, c1-1)
+}
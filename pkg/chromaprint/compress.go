@@ -0,0 +1,157 @@
+package chromaprint
+
+import "encoding/base64"
+
+const (
+	maxNormalValue = 7
+	normalBits     = 3
+	exceptionBits  = 5
+)
+
+// EncodeFingerprint compresses a raw fingerprint and returns it in the base64
+// form accepted by the AcoustID web service and printed by fpcalc
+func EncodeFingerprint(raw []uint32, algorithm int) string {
+	return base64.RawURLEncoding.EncodeToString(compress(raw, algorithm))
+}
+
+// DecodeFingerprint decodes a base64 compressed fingerprint, as returned by
+// EncodeFingerprint and fpcalc, into its raw sub-fingerprints and algorithm
+func DecodeFingerprint(encoded string) ([]uint32, int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, 0, ErrInvalidEncoding
+	}
+
+	return decompress(data)
+}
+
+// compress encodes the bit positions that change between consecutive
+// sub-fingerprints. Small deltas are stored with 3 bits, larger ones overflow
+// into a second array of 5 bit values
+func compress(raw []uint32, algorithm int) []byte {
+	var normal, exceptional []byte
+
+	prev := uint32(0)
+	for _, sub := range raw {
+		x := sub ^ prev
+		prev = sub
+
+		bit, lastBit := 1, 0
+		for x != 0 {
+			if x&1 != 0 {
+				value := bit - lastBit
+				if value >= maxNormalValue {
+					normal = append(normal, maxNormalValue)
+					exceptional = append(exceptional, byte(value-maxNormalValue))
+				} else {
+					normal = append(normal, byte(value))
+				}
+				lastBit = bit
+			}
+			x >>= 1
+			bit++
+		}
+		normal = append(normal, 0)
+	}
+
+	size := len(raw)
+	out := []byte{byte(algorithm), byte(size >> 16), byte(size >> 8), byte(size)}
+	out = append(out, packInts(normal, normalBits)...)
+	out = append(out, packInts(exceptional, exceptionBits)...)
+
+	return out
+}
+
+// packInts packs the lowest bits of each value into a little endian bit stream
+func packInts(values []byte, bits uint) []byte {
+	out := make([]byte, (len(values)*int(bits)+7)/8)
+
+	var pos uint
+	for _, v := range values {
+		for b := uint(0); b < bits; b++ {
+			if v&(1<<b) != 0 {
+				out[pos/8] |= 1 << (pos % 8)
+			}
+			pos++
+		}
+	}
+
+	return out
+}
+
+// decompress reverses compress
+func decompress(data []byte) ([]uint32, int, error) {
+	if len(data) < 4 {
+		return nil, 0, ErrInvalidEncoding
+	}
+
+	algorithm := int(data[0])
+	size := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	data = data[4:]
+
+	// the normal values end after the size-th zero value
+	var normal []byte
+	var exceptions int
+	for zeros, pos := 0, uint(0); zeros < size; pos += normalBits {
+		if pos+normalBits > uint(len(data))*8 {
+			return nil, 0, ErrInvalidEncoding
+		}
+
+		v := unpackInt(data, pos, normalBits)
+		switch v {
+		case 0:
+			zeros++
+		case maxNormalValue:
+			exceptions++
+		}
+		normal = append(normal, v)
+	}
+
+	data = data[(len(normal)*normalBits+7)/8:]
+	if len(data)*8 < exceptions*exceptionBits {
+		return nil, 0, ErrInvalidEncoding
+	}
+
+	raw := make([]uint32, 0, size)
+	var x uint32
+	var lastBit int
+	var exception uint
+	for _, v := range normal {
+		if v == 0 {
+			// each sub-fingerprint stores the bits changed from the previous one
+			if len(raw) > 0 {
+				x ^= raw[len(raw)-1]
+			}
+			raw = append(raw, x)
+			x, lastBit = 0, 0
+			continue
+		}
+
+		bit := lastBit + int(v)
+		if v == maxNormalValue {
+			bit += int(unpackInt(data, exception*exceptionBits, exceptionBits))
+			exception++
+		}
+		if bit > 32 {
+			return nil, 0, ErrInvalidEncoding
+		}
+
+		x |= 1 << uint(bit-1)
+		lastBit = bit
+	}
+
+	return raw, algorithm, nil
+}
+
+// unpackInt reads the bits long value starting at the pos bit of a little endian
+// bit stream
+func unpackInt(data []byte, pos uint, bits uint) byte {
+	var v byte
+	for b := uint(0); b < bits; b++ {
+		if data[(pos+b)/8]&(1<<((pos+b)%8)) != 0 {
+			v |= 1 << b
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,85 @@
+package chromaprint
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// fft is a radix-2 fast Fourier transform of a fixed size
+type fft struct {
+	size    int
+	twiddle []complex128
+	rev     []int
+	buf     []complex128
+	power   []float64
+}
+
+func newFFT(size int) *fft {
+	bits := 0
+	for 1<<uint(bits) < size {
+		bits++
+	}
+
+	rev := make([]int, size)
+	for i := range rev {
+		var r int
+		for b := 0; b < bits; b++ {
+			if i&(1<<uint(b)) != 0 {
+				r |= 1 << uint(bits-1-b)
+			}
+		}
+		rev[i] = r
+	}
+
+	twiddle := make([]complex128, size/2)
+	for i := range twiddle {
+		twiddle[i] = cmplx.Exp(complex(0, -2*math.Pi*float64(i)/float64(size)))
+	}
+
+	return &fft{
+		size:    size,
+		twiddle: twiddle,
+		rev:     rev,
+		buf:     make([]complex128, size),
+		power:   make([]float64, size/2+1),
+	}
+}
+
+// powerSpectrum windows the input frame and returns the squared magnitude of
+// its first size/2+1 frequency bins. The returned slice is reused by the
+// next call
+func (f *fft) powerSpectrum(frame []int16, window []float64) []float64 {
+	for i, s := range frame {
+		f.buf[f.rev[i]] = complex(float64(s)*window[i], 0)
+	}
+
+	for size := 2; size <= f.size; size <<= 1 {
+		half := size / 2
+		step := f.size / size
+		for start := 0; start < f.size; start += size {
+			for k := 0; k < half; k++ {
+				t := f.twiddle[k*step] * f.buf[start+k+half]
+				u := f.buf[start+k]
+				f.buf[start+k] = u + t
+				f.buf[start+k+half] = u - t
+			}
+		}
+	}
+
+	for i := range f.power {
+		re, im := real(f.buf[i]), imag(f.buf[i])
+		f.power[i] = re*re + im*im
+	}
+
+	return f.power
+}
+
+// hammingWindow returns a Hamming window of the given size multiplied by scale
+func hammingWindow(size int, scale float64) []float64 {
+	w := make([]float64, size)
+	for i := range w {
+		w[i] = scale * (0.54 - 0.46*math.Cos(float64(i)*2*math.Pi/float64(size-1)))
+	}
+
+	return w
+}
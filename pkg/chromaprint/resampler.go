@@ -0,0 +1,208 @@
+package chromaprint
+
+import "math"
+
+const (
+	// resampler parameters mirror the ones chromaprint's AudioProcessor passes
+	// to its bundled libavcodec resampler (av_resample_init). The phase shift is
+	// chromaprint's kResamplePhaseShift, not libavcodec's default of 10
+	resampleFilterLength = 16
+	resamplePhaseShift   = 8
+	resampleCutoff       = 0.8
+	resampleKaiserBeta   = 9
+
+	// resampleFilterShift is the fixed point precision of the filter
+	// coefficients
+	resampleFilterShift = 15
+
+	// resampleBufferSize is the size of the input buffer chromaprint resamples
+	// at once
+	resampleBufferSize = 1024 * 32
+)
+
+// resampler converts mono audio between sample rates. It is a port of the
+// fixed point polyphase resampler bundled with chromaprint (resample2.c from
+// libavcodec) and of the buffering done by chromaprint's AudioProcessor, so that
+// the samples reaching the fingerprinting pipeline are the same as in fpcalc
+type resampler struct {
+	filterLength int
+	phaseMask    int
+	// filterBank holds filterLength fixed point coefficients for each phase
+	filterBank []int16
+
+	// index is the position of the next output sample, in input samples shifted
+	// by resamplePhaseShift. frac accumulates the remainder of dstIncr/srcIncr
+	index   int
+	frac    int
+	srcIncr int
+	dstIncr int
+
+	buf    []int16
+	offset int
+}
+
+func newResampler(inRate int, outRate int) *resampler {
+	factor := math.Min(float64(outRate)*resampleCutoff/float64(inRate), 1.0)
+	phaseCount := 1 << resamplePhaseShift
+
+	filterLength := int(math.Ceil(resampleFilterLength / factor))
+	if filterLength < 1 {
+		filterLength = 1
+	}
+
+	srcIncr, dstIncr := reduce(outRate, inRate*phaseCount)
+
+	return &resampler{
+		filterLength: filterLength,
+		phaseMask:    phaseCount - 1,
+		filterBank:   buildFilter(factor, filterLength, phaseCount, 1<<resampleFilterShift),
+		index:        -phaseCount * ((filterLength - 1) / 2),
+		srcIncr:      srcIncr,
+		dstIncr:      dstIncr,
+		buf:          make([]int16, resampleBufferSize),
+	}
+}
+
+// process appends samples to the resampler input and returns the output samples
+// calculated when the input buffer fills up. When flush is true the input is
+// considered complete and the buffered samples are resampled too. Like in
+// chromaprint, the last samples that don't fill the filter are dropped
+func (r *resampler) process(samples []int16, flush bool) []int16 {
+	var out []int16
+	for len(samples) > 0 {
+		n := copy(r.buf[r.offset:], samples)
+		samples = samples[n:]
+		r.offset += n
+
+		if r.offset == len(r.buf) {
+			out = r.resample(out)
+		}
+	}
+
+	if flush && r.offset > 0 {
+		out = r.resample(out)
+	}
+
+	return out
+}
+
+// resample resamples the buffered input, appending the result to out, and
+// keeps the input samples the next outputs still depend on
+func (r *resampler) resample(out []int16) []int16 {
+	src := r.buf[:r.offset]
+	index, frac := r.index, r.frac
+	dstIncrFrac := r.dstIncr % r.srcIncr
+	dstIncr := r.dstIncr / r.srcIncr
+
+	for {
+		filter := r.filterBank[r.filterLength*(index&r.phaseMask):][:r.filterLength]
+		sampleIndex := index >> resamplePhaseShift
+
+		// the filter is evaluated with 32 bit integers, which wrap on overflow
+		// like in the C implementation
+		var val int32
+		if sampleIndex < 0 {
+			for i, c := range filter {
+				val += int32(src[abs(sampleIndex+i)%len(src)]) * int32(c)
+			}
+		} else if sampleIndex+r.filterLength > len(src) {
+			break
+		} else {
+			for i, c := range filter {
+				val += int32(src[sampleIndex+i]) * int32(c)
+			}
+		}
+
+		val = (val + 1<<(resampleFilterShift-1)) >> resampleFilterShift
+		if uint32(val+32768) > 65535 {
+			val = (val >> 31) ^ 32767
+		}
+		out = append(out, int16(val))
+
+		frac += dstIncrFrac
+		index += dstIncr
+		if frac >= r.srcIncr {
+			frac -= r.srcIncr
+			index++
+		}
+	}
+
+	consumed := 0
+	if index > 0 {
+		consumed = index >> resamplePhaseShift
+	}
+	if index >= 0 {
+		index &= r.phaseMask
+	}
+	r.index, r.frac = index, frac
+
+	if consumed > r.offset {
+		consumed = r.offset
+	}
+	r.offset = copy(r.buf, r.buf[consumed:r.offset])
+
+	return out
+}
+
+// buildFilter returns the fixed point coefficients of a Kaiser windowed sinc low
+// pass filter for each of the phases an output sample can fall on
+func buildFilter(factor float64, tapCount int, phaseCount int, scale int) []int16 {
+	center := (tapCount - 1) / 2
+	bank := make([]int16, tapCount*phaseCount)
+	tab := make([]float64, tapCount)
+
+	for ph := 0; ph < phaseCount; ph++ {
+		var norm float64
+		for i := range tab {
+			x := math.Pi * (float64(i-center) - float64(ph)/float64(phaseCount)) * factor
+			y := 1.0
+			if x != 0 {
+				y = math.Sin(x) / x
+			}
+
+			w := 2.0 * x / (factor * float64(tapCount) * math.Pi)
+			y *= bessel(resampleKaiserBeta * math.Sqrt(math.Max(1-w*w, 0)))
+
+			tab[i] = y
+			norm += y
+		}
+
+		for i, y := range tab {
+			// lrintf rounds the single precision value half to even
+			v := math.RoundToEven(float64(float32(y * float64(scale) / norm)))
+			bank[ph*tapCount+i] = int16(math.Max(math.Min(v, math.MaxInt16), math.MinInt16))
+		}
+	}
+
+	return bank
+}
+
+// bessel is the zeroth order modified Bessel function of the first kind
+func bessel(x float64) float64 {
+	v, t := 1.0, 1.0
+	x = x * x / 4
+	for i := 1; i < 50; i++ {
+		t *= x / float64(i*i)
+		v += t
+	}
+
+	return v
+}
+
+// reduce returns num/den as an irreducible fraction
+func reduce(num int, den int) (int, int) {
+	a, b := num, den
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return num / a, den / a
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
@@ -0,0 +1,278 @@
+package fingerprint
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	// DefaultArchiveMaxEntries is the maximum number of entries of a scanned archive
+	DefaultArchiveMaxEntries = 10000
+	// DefaultArchiveMaxBytes is the maximum decompressed size of a scanned archive
+	DefaultArchiveMaxBytes int64 = 4 << 30
+)
+
+// archiveSuffixes are the file name suffixes of the supported archives
+var archiveSuffixes = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+// archiveLimits guard against archives decompressing to more data or entries
+// than can reasonably be fingerprinted, such as zip bombs
+type archiveLimits struct {
+	maxEntries int
+	maxBytes   int64
+}
+
+// WithArchiveLimits sets the maximum number of entries and decompressed bytes of
+// the archives ChromaPrint scans. Scanning an archive stops with
+// ErrArchiveTooManyEntries or ErrArchiveTooLarge when a limit is exceeded. They
+// default to DefaultArchiveMaxEntries and DefaultArchiveMaxBytes
+func WithArchiveLimits(maxEntries int, maxBytes int64) ChromaPrintOption {
+	return func(c *ChromaPrint) {
+		c.archive = archiveLimits{maxEntries: maxEntries, maxBytes: maxBytes}
+	}
+}
+
+// isArchiveName reports whether name looks like a supported archive
+func isArchiveName(name string) bool {
+	name = strings.ToLower(name)
+	for _, suffix := range archiveSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// archiveEntry is a regular file stored in an archive. name is the slash
+// separated path of the file inside the archive
+type archiveEntry struct {
+	name string
+	info os.FileInfo
+	open func() (io.ReadCloser, error)
+}
+
+// archiveBudget counts the bytes decompressed from an archive
+type archiveBudget struct {
+	remaining int64
+}
+
+func (b *archiveBudget) exceeded() bool {
+	return b.remaining < 0
+}
+
+// reader returns a reader failing with ErrArchiveTooLarge once the budget is
+// exceeded
+func (b *archiveBudget) reader(r io.Reader) io.Reader {
+	return &budgetReader{r: r, budget: b}
+}
+
+type budgetReader struct {
+	r      io.Reader
+	budget *archiveBudget
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	if b.budget.exceeded() {
+		return 0, ErrArchiveTooLarge
+	}
+
+	n, err := b.r.Read(p)
+	b.budget.remaining -= int64(n)
+	if b.budget.exceeded() {
+		return n, ErrArchiveTooLarge
+	}
+
+	return n, err
+}
+
+// walkArchive calls fn for each regular file of the archive at fPath, in the
+// order they are stored. The decompressed bytes are charged to budget. The walk
+// stops at the first error returned by fn
+func walkArchive(fs afero.Fs, fPath string, maxEntries int, budget *archiveBudget, fn func(e archiveEntry) error) error {
+	f, err := fs.Open(fPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	name := strings.ToLower(fPath)
+	if strings.HasSuffix(name, ".zip") {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		return walkZip(f, info.Size(), maxEntries, budget, fn)
+	}
+
+	var r io.Reader = f
+	if strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	// the whole tar stream is charged, as skipping an entry decompresses it too
+	return walkTar(budget.reader(r), maxEntries, fn)
+}
+
+func walkZip(r io.ReaderAt, size int64, maxEntries int, budget *archiveBudget, fn func(e archiveEntry) error) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+
+	if len(zr.File) > maxEntries {
+		return ErrArchiveTooManyEntries
+	}
+
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+
+		zf := zf
+		open := func() (io.ReadCloser, error) {
+			rc, err := zf.Open()
+			if err != nil {
+				return nil, err
+			}
+
+			return readCloser{Reader: budget.reader(rc), Closer: rc}, nil
+		}
+
+		if err := fn(archiveEntry{name: entryName(zf.Name), info: zf.FileInfo(), open: open}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkTar(r io.Reader, maxEntries int, fn func(e archiveEntry) error) error {
+	tr := tar.NewReader(r)
+
+	for entries := 1; ; entries++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if entries > maxEntries {
+			return ErrArchiveTooManyEntries
+		}
+
+		info := hdr.FileInfo()
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		open := func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(tr), nil
+		}
+
+		if err := fn(archiveEntry{name: entryName(hdr.Name), info: info, open: open}); err != nil {
+			return err
+		}
+	}
+}
+
+// entryName normalises the name of an archive entry. Names are only used to
+// report the entries, they are never used to write files
+func entryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// scanArchive fingerprints the audio entries of the archive at fPath one at a
+// time, streaming them to calcReader. Entries are selected with the include and
+// exclude patterns, matched against their path inside the archive. When ctx is
+// done or an archive limit is exceeded the fingerprints calculated so far are
+// returned along with the error
+func (s *scanner) scanArchive(ctx context.Context, fPath string) (*BatchResult, error) {
+	for _, pattern := range append(s.walk.include, s.walk.exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	absPath, err := filepath.Abs(fPath)
+	if err != nil {
+		return nil, err
+	}
+
+	budget := &archiveBudget{remaining: s.archive.maxBytes}
+	res := &BatchResult{Fingerprints: []*Fingerprint{}}
+
+	err = walkArchive(s.fs, fPath, s.archive.maxEntries, budget, func(e archiveEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if matchesAny(s.walk.exclude, e.name) || (len(s.walk.include) > 0 && !matchesAny(s.walk.include, e.name)) {
+			return nil
+		}
+
+		// entries are only discovered once their content is sniffed
+		entryPath := filepath.Join(fPath, filepath.FromSlash(e.name))
+
+		fing, err := s.calcEntry(ctx, e)
+		switch {
+		case budget.exceeded():
+			return ErrArchiveTooLarge
+		case err == nil:
+			fing.RelPath = e.name
+			fing.Source.Path = absPath
+			fing.Source.Entry = e.name
+			fing.Source.ModTime = e.info.ModTime().UTC()
+			res.Fingerprints = append(res.Fingerprints, fing)
+			s.progress.Discovered(entryPath)
+			s.progress.Fingerprinted(entryPath)
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, ErrInvalidFormat) && (s.isAudioName == nil || !s.isAudioName(path.Base(e.name))):
+			// entries that aren't audio files are skipped
+		default:
+			fileErr := newFileError(audioFile{path: fPath, relPath: e.name}, err)
+			res.Failures = append(res.Failures, fileErr)
+			s.progress.Discovered(entryPath)
+			s.progress.Failed(entryPath, fileErr)
+		}
+
+		return nil
+	})
+
+	return res, err
+}
+
+func (s *scanner) calcEntry(ctx context.Context, e archiveEntry) (*Fingerprint, error) {
+	r, err := e.open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return s.calcReader(ctx, r)
+}
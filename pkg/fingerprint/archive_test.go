@@ -0,0 +1,156 @@
+package fingerprint
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ocramh/fingerprinter/pkg/fingerprint/fingerprinttest"
+)
+
+type testEntry struct {
+	name    string
+	content []byte
+}
+
+var (
+	testEntryTime = time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	testArchiveEntries = []testEntry{
+		{"album/01.mp3", append(mp3Header, bytes.Repeat([]byte("one"), 100)...)},
+		{"album/02.mp3", append(mp3Header, bytes.Repeat([]byte("two"), 200)...)},
+		{"album/cover.txt", []byte("not audio")},
+		{"broken.mp3", []byte("not audio either")},
+	}
+)
+
+func zipBytes(entries []testEntry) []byte {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, e := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: testEntryTime})
+		if err != nil {
+			panic(err)
+		}
+		w.Write(e.content)
+	}
+	zw.Close()
+
+	return buf.Bytes()
+}
+
+func tarGzBytes(entries []testEntry) []byte {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: "./" + e.name, Mode: 0644, Size: int64(len(e.content)), ModTime: testEntryTime}
+		if err := tw.WriteHeader(hdr); err != nil {
+			panic(err)
+		}
+		tw.Write(e.content)
+	}
+	tw.Close()
+	gz.Close()
+
+	return buf.Bytes()
+}
+
+func TestFingerprintArchive(t *testing.T) {
+	archives := map[string][]byte{
+		"album.zip":    zipBytes(testArchiveEntries),
+		"album.tar.gz": tarGzBytes(testArchiveEntries),
+	}
+
+	for name, content := range archives {
+		t.Run(name, func(t *testing.T) {
+			mockFS := mustSetupFS()
+			archivePath := path.Join(testDataDir, name)
+			assert.NoError(t, afero.WriteFile(mockFS, archivePath, content, 0644))
+
+			fpcalc := fingerprinttest.NewFPcalc(t)
+			chromap := mustNewChromaPrint(fpcalc.ExecCmd, mockFS)
+			got, err := chromap.CalcFingerprint(archivePath)
+			assert.NoError(t, err)
+
+			sort.Slice(got.Fingerprints, func(i, j int) bool {
+				return got.Fingerprints[i].RelPath < got.Fingerprints[j].RelPath
+			})
+
+			// the entries are streamed to fpcalc in order
+			calls := fpcalc.Calls()[1:]
+			assert.Len(t, calls, 2)
+			assert.Len(t, got.Fingerprints, 2)
+			for i, fing := range got.Fingerprints {
+				entry := testArchiveEntries[i]
+				assert.Equal(t, entry.content, calls[i].Stdin())
+				assert.Equal(t, entry.name, fing.RelPath)
+				assert.Equal(t, ContainerMP3, fing.Container)
+
+				absPath, _ := filepath.Abs(archivePath)
+				assert.Equal(t, absPath, fing.Source.Path)
+				assert.Equal(t, entry.name, fing.Source.Entry)
+				assert.Equal(t, absPath+"!/"+entry.name, fing.Path())
+				assert.Equal(t, int64(len(entry.content)), fing.Source.Size)
+				assert.True(t, testEntryTime.Equal(fing.Source.ModTime))
+			}
+
+			assert.Len(t, got.Failures, 1)
+			assert.Equal(t, archivePath, got.Failures[0].Path)
+			assert.Equal(t, "broken.mp3", got.Failures[0].RelPath)
+			assert.Equal(t, FailureUnsupportedFormat, got.Failures[0].Kind)
+		})
+	}
+}
+
+func TestFingerprintArchivePatterns(t *testing.T) {
+	mockFS := mustSetupFS()
+	archivePath := path.Join(testDataDir, "album.zip")
+	assert.NoError(t, afero.WriteFile(mockFS, archivePath, zipBytes(testArchiveEntries), 0644))
+
+	chromap := mustNewChromaPrint(mockExec(t), mockFS, WithIncludePatterns("album/*"), WithExcludePatterns("02.mp3"))
+	got, err := chromap.CalcFingerprint(archivePath)
+	assert.NoError(t, err)
+	assert.Len(t, got.Fingerprints, 1)
+	assert.Equal(t, "album/01.mp3", got.Fingerprints[0].RelPath)
+	assert.Empty(t, got.Failures)
+}
+
+func TestFingerprintArchiveLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		// maxBytes is exceeded while reading the second entry. The tar headers
+		// count towards the limit
+		maxBytes int64
+	}{
+		{"album.zip", zipBytes(testArchiveEntries), 700},
+		{"album.tar.gz", tarGzBytes(testArchiveEntries), 1600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockFS := mustSetupFS()
+			archivePath := path.Join(testDataDir, tt.name)
+			assert.NoError(t, afero.WriteFile(mockFS, archivePath, tt.content, 0644))
+
+			chromap := mustNewChromaPrint(mockExec(t), mockFS, WithArchiveLimits(2, DefaultArchiveMaxBytes))
+			_, err := chromap.CalcFingerprint(archivePath)
+			assert.Equal(t, ErrArchiveTooManyEntries, err)
+
+			chromap = mustNewChromaPrint(mockExec(t), mockFS, WithArchiveLimits(10, tt.maxBytes))
+			got, err := chromap.CalcFingerprint(archivePath)
+			assert.Equal(t, ErrArchiveTooLarge, err)
+			assert.Len(t, got.Fingerprints, 1)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package fingerprint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// BatchResult is the outcome of fingerprinting an input path. Files that couldn't
+// be fingerprinted are reported in Failures and don't affect the other results
+type BatchResult struct {
+	Fingerprints []*Fingerprint `json:"fingerprints"`
+	Failures     []*FileError   `json:"failures,omitempty"`
+}
+
+// FailureKind classifies the cause of a FileError
+type FailureKind string
+
+const (
+	FailureDecode            FailureKind = "decode"
+	FailureTimeout           FailureKind = "timeout"
+	FailureCanceled          FailureKind = "canceled"
+	FailureUnsupportedFormat FailureKind = "unsupported_format"
+	FailureIO                FailureKind = "io"
+	FailureUnknown           FailureKind = "unknown"
+)
+
+// FileError is the error returned when a single file can't be fingerprinted
+type FileError struct {
+	Path    string
+	RelPath string
+	Kind    FailureKind
+	Err     error
+}
+
+func newFileError(f audioFile, err error) *FileError {
+	var fileErr *FileError
+	if errors.As(err, &fileErr) {
+		return fileErr
+	}
+
+	return &FileError{
+		Path:    f.path,
+		RelPath: f.relPath,
+		Kind:    failureKind(err),
+		Err:     err,
+	}
+}
+
+func (f *FileError) Error() string {
+	return fmt.Sprintf("%s: %s error: %s", f.Path, f.Kind, f.Err)
+}
+
+func (f *FileError) Unwrap() error {
+	return f.Err
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (f *FileError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Path    string      `json:"path"`
+		RelPath string      `json:"relpath,omitempty"`
+		Kind    FailureKind `json:"kind"`
+		Error   string      `json:"error"`
+	}{f.Path, f.RelPath, f.Kind, f.Err.Error()})
+}
+
+// failureKind maps the error returned while fingerprinting a file to a FailureKind
+func failureKind(err error) FailureKind {
+	var exitErr *exec.ExitError
+	var syntaxErr *json.SyntaxError
+	var pathErr *os.PathError
+	var fpcalcErr *FPcalcError
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return FailureTimeout
+	case errors.Is(err, context.Canceled):
+		return FailureCanceled
+	case errors.Is(err, ErrInvalidFormat), errors.Is(err, ErrUnsupportedCodec), errors.Is(err, ErrNoAudioStream):
+		return FailureUnsupportedFormat
+	case errors.As(err, &pathErr), errors.Is(err, ErrOpenFailed):
+		return FailureIO
+	case errors.As(err, &fpcalcErr), errors.Is(err, ErrInvalidWAV), errors.As(err, &exitErr), errors.As(err, &syntaxErr):
+		return FailureDecode
+	}
+
+	return FailureUnknown
+}
@@ -0,0 +1,243 @@
+package fingerprint
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var cacheBucket = []byte("fingerprints")
+
+// cacheTouchInterval is how often the last use time of a cached fingerprint is
+// refreshed. Refreshing it on every hit would make rescans of cached files
+// write to the database for each file, and Prune doesn't need a finer precision
+const cacheTouchInterval = time.Hour
+
+// Cache is an on-disk store of fingerprints backed by a bbolt database.
+// Fingerprints are keyed by the content hash of the audio files and by the
+// fpcalc version and options used to calculate them
+type Cache struct {
+	db          *bolt.DB
+	hits        int64
+	misses      int64
+	writeErrors int64
+}
+
+// CacheStats describes the content and usage of a Cache. Hits and Misses count
+// the lookups made since the Cache was opened, and WriteErrors the fingerprints
+// that couldn't be stored
+type CacheStats struct {
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`
+	WriteErrors int64 `json:"write_errors"`
+	Entries     int   `json:"entries"`
+	Size        int64 `json:"size"`
+}
+
+// cacheEntry is the value stored for each cached fingerprint
+type cacheEntry struct {
+	Fingerprint *Fingerprint `json:"fingerprint"`
+	LastUsed    time.Time    `json:"last_used"`
+}
+
+// OpenCache opens the cache database at path, creating it if it doesn't exist.
+// A database can only be opened by one process at a time
+func OpenCache(path string) (*Cache, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(cacheBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Cache{db: db}, nil
+}
+
+// Close closes the cache database
+func (c *Cache) Close() error {
+	return c.db.Close()
+}
+
+// Stats returns the cache statistics
+func (c *Cache) Stats() (CacheStats, error) {
+	stats := CacheStats{
+		Hits:        atomic.LoadInt64(&c.hits),
+		Misses:      atomic.LoadInt64(&c.misses),
+		WriteErrors: atomic.LoadInt64(&c.writeErrors),
+	}
+
+	err := c.db.View(func(tx *bolt.Tx) error {
+		stats.Entries = tx.Bucket(cacheBucket).Stats().KeyN
+		stats.Size = tx.Size()
+		return nil
+	})
+
+	return stats, err
+}
+
+// Clear removes all the cached fingerprints
+func (c *Cache) Clear() error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(cacheBucket); err != nil {
+			return err
+		}
+
+		_, err := tx.CreateBucket(cacheBucket)
+		return err
+	})
+}
+
+// Prune removes the fingerprints that haven't been used for longer than maxAge
+// and returns the number of removed fingerprints
+func (c *Cache) Prune(maxAge time.Duration) (int, error) {
+	threshold := time.Now().Add(-maxAge)
+
+	var removed int
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(cacheBucket)
+
+		var expired [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var entry cacheEntry
+			if err := json.Unmarshal(v, &entry); err != nil || entry.LastUsed.Before(threshold) {
+				expired = append(expired, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(expired)
+
+		return nil
+	})
+
+	return removed, err
+}
+
+// get returns the fingerprint stored at key, or nil if there is none, and
+// updates its last use time when it is older than cacheTouchInterval. A failed
+// update is only counted, the fingerprint is still returned
+func (c *Cache) get(key []byte) (*Fingerprint, error) {
+	var entry *cacheEntry
+	err := c.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(cacheBucket).Get(key)
+		if v == nil {
+			return nil
+		}
+
+		entry = &cacheEntry{}
+		return json.Unmarshal(v, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		atomic.AddInt64(&c.misses, 1)
+		return nil, nil
+	}
+	atomic.AddInt64(&c.hits, 1)
+
+	if now := time.Now(); now.Sub(entry.LastUsed) >= cacheTouchInterval {
+		entry.LastUsed = now
+		c.tryPut(key, entry)
+	}
+
+	return entry.Fingerprint, nil
+}
+
+// put stores entry at key. Concurrent writes are grouped in a single transaction
+func (c *Cache) put(key []byte, entry *cacheEntry) error {
+	v, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return c.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(cacheBucket).Put(key, v)
+	})
+}
+
+// tryPut is like put but only counts the failed writes, as the cache is an
+// optimisation that mustn't fail fingerprinting
+func (c *Cache) tryPut(key []byte, entry *cacheEntry) {
+	if err := c.put(key, entry); err != nil {
+		atomic.AddInt64(&c.writeErrors, 1)
+	}
+}
+
+// CachedFingerprinter is a Fingerprinter that decorates ChromaPrint with a
+// Cache. Only the files whose content or fingerprinting options changed since
+// they were cached are fingerprinted with fpcalc
+type CachedFingerprinter struct {
+	chroma *ChromaPrint
+	cache  *Cache
+}
+
+func NewCachedFingerprinter(chroma *ChromaPrint, cache *Cache) *CachedFingerprinter {
+	return &CachedFingerprinter{
+		chroma: chroma,
+		cache:  cache,
+	}
+}
+
+// CalcFingerprint is like ChromaPrint.CalcFingerprint but returns the cached
+// fingerprints when available
+func (c *CachedFingerprinter) CalcFingerprint(fPath string) (*BatchResult, error) {
+	return c.CalcFingerprintContext(context.Background(), fPath)
+}
+
+// CalcFingerprintContext is like ChromaPrint.CalcFingerprintContext but returns
+// the cached fingerprints when available
+func (c *CachedFingerprinter) CalcFingerprintContext(ctx context.Context, fPath string) (*BatchResult, error) {
+	return c.chroma.scan(ctx, fPath, c.fingerprintFile)
+}
+
+// Version returns the version of the fpcalc executable
+func (c *CachedFingerprinter) Version() FPcalcVersion {
+	return c.chroma.Version()
+}
+
+func (c *CachedFingerprinter) fingerprintFile(ctx context.Context, f audioFile) (*Fingerprint, error) {
+	src, err := newSource(c.chroma.os, f)
+	if err != nil {
+		return nil, err
+	}
+
+	key := []byte(src.Hash + " " + c.chroma.optionsKey())
+	fing, err := c.cache.get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if fing == nil {
+		fing, err = c.chroma.fingerprintFile(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+
+		c.cache.tryPut(key, &cacheEntry{Fingerprint: fing, LastUsed: time.Now()})
+	}
+
+	// the cached file might have been moved or renamed
+	fing.Source = src
+
+	return fing, nil
+}
@@ -0,0 +1,194 @@
+package fingerprint
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ocramh/fingerprinter/pkg/fingerprint/fingerprinttest"
+)
+
+func mustOpenCache(t *testing.T) *Cache {
+	dir, err := ioutil.TempDir("", "fingerprinter-cache")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	cache, err := OpenCache(filepath.Join(dir, "fingerprints.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { cache.Close() })
+
+	return cache
+}
+
+func TestCachedFingerprinter(t *testing.T) {
+	mockFS := mustSetupFS()
+	cache := mustOpenCache(t)
+
+	fpcalc := fingerprinttest.NewFPcalc(t)
+	cached := NewCachedFingerprinter(mustNewChromaPrint(fpcalc.ExecCmd, mockFS), cache)
+
+	first, err := cached.CalcFingerprint(testDataDir)
+	assert.NoError(t, err)
+	assert.Len(t, first.Fingerprints, 2)
+	assert.Len(t, fpcalc.Paths(), 2)
+
+	second, err := cached.CalcFingerprint(testDataDir)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, first.Fingerprints, second.Fingerprints)
+	assert.Len(t, fpcalc.Paths(), 2)
+
+	stats, err := cache.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+	assert.Equal(t, 2, stats.Entries)
+	assert.True(t, stats.Size > 0)
+}
+
+func TestCachedFingerprinterWriteErrors(t *testing.T) {
+	mockFS := mustSetupFS()
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "fingerprints.db")
+	cache, err := OpenCache(dbPath)
+	assert.NoError(t, err)
+	assert.NoError(t, cache.Close())
+
+	// a read-only database fails every write
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{ReadOnly: true})
+	assert.NoError(t, err)
+	cache = &Cache{db: db}
+	defer cache.Close()
+
+	cached := NewCachedFingerprinter(mustNewChromaPrint(mockExec(t), mockFS), cache)
+	got, err := cached.CalcFingerprint(testDataDir)
+	assert.NoError(t, err)
+	assert.Len(t, got.Fingerprints, 2)
+	assert.Empty(t, got.Failures)
+
+	stats, err := cache.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), stats.WriteErrors)
+	assert.Equal(t, 0, stats.Entries)
+}
+
+func TestCachedFingerprinterMovedFile(t *testing.T) {
+	mockFS := mustSetupFS()
+	cache := mustOpenCache(t)
+
+	fpcalc := fingerprinttest.NewFPcalc(t)
+	cached := NewCachedFingerprinter(mustNewChromaPrint(fpcalc.ExecCmd, mockFS), cache)
+
+	_, err := cached.CalcFingerprint(path.Join(testDataDir, testFile1))
+	assert.NoError(t, err)
+
+	movedFile := path.Join(testDataDir, "moved.mp3")
+	assert.NoError(t, mockFS.Rename(path.Join(testDataDir, testFile1), movedFile))
+
+	got, err := cached.CalcFingerprint(movedFile)
+	assert.NoError(t, err)
+	assert.Len(t, fpcalc.Paths(), 1)
+	assert.Equal(t, "moved.mp3", got.Fingerprints[0].RelPath)
+	assert.Equal(t, mustSource(mockFS, movedFile), got.Fingerprints[0].Source)
+}
+
+func TestCachedFingerprinterInvalidation(t *testing.T) {
+	mockFS := mustSetupFS()
+	cache := mustOpenCache(t)
+	inputFile := path.Join(testDataDir, testFile1)
+
+	fpcalc := fingerprinttest.NewFPcalc(t)
+	cached := NewCachedFingerprinter(mustNewChromaPrint(fpcalc.ExecCmd, mockFS), cache)
+	_, err := cached.CalcFingerprint(inputFile)
+	assert.NoError(t, err)
+	assert.Len(t, fpcalc.Paths(), 1)
+
+	// a change of content
+	assert.NoError(t, afero.WriteFile(mockFS, inputFile, append(mp3Header, []byte("edited")...), 0644))
+	_, err = cached.CalcFingerprint(inputFile)
+	assert.NoError(t, err)
+	assert.Len(t, fpcalc.Paths(), 2)
+
+	// a change of options
+	cached = NewCachedFingerprinter(mustNewChromaPrint(fpcalc.ExecCmd, mockFS, WithLength(0)), cache)
+	_, err = cached.CalcFingerprint(inputFile)
+	assert.NoError(t, err)
+	assert.Len(t, fpcalc.Paths(), 3)
+}
+
+func TestCachedFingerprinterFailuresNotCached(t *testing.T) {
+	mockFS := mustSetupFS()
+	cache := mustOpenCache(t)
+
+	cached := NewCachedFingerprinter(mustNewChromaPrint(mockFailExec(t), mockFS), cache)
+	got, err := cached.CalcFingerprint(testDataDir)
+	assert.NoError(t, err)
+	assert.Len(t, got.Failures, 2)
+
+	stats, err := cache.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.Entries)
+}
+
+func TestCachePruneAndClear(t *testing.T) {
+	mockFS := mustSetupFS()
+	cache := mustOpenCache(t)
+
+	cached := NewCachedFingerprinter(mustNewChromaPrint(mockExec(t), mockFS), cache)
+	_, err := cached.CalcFingerprint(testDataDir)
+	assert.NoError(t, err)
+
+	removed, err := cache.Prune(time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+
+	// entries last used earlier than the max age are removed
+	assert.NoError(t, cache.put([]byte("old"), &cacheEntry{Fingerprint: &Fingerprint{}, LastUsed: time.Now().Add(-2 * time.Hour)}))
+	removed, err = cache.Prune(time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	stats, err := cache.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Entries)
+
+	assert.NoError(t, cache.Clear())
+	stats, err = cache.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.Entries)
+}
+
+func TestCacheGetRefreshesStaleLastUsed(t *testing.T) {
+	cache := mustOpenCache(t)
+
+	lastUsed := func(key string) time.Time {
+		var entry cacheEntry
+		assert.NoError(t, cache.db.View(func(tx *bolt.Tx) error {
+			return json.Unmarshal(tx.Bucket(cacheBucket).Get([]byte(key)), &entry)
+		}))
+		return entry.LastUsed
+	}
+
+	recent := time.Now().Add(-time.Minute).Round(0)
+	stale := time.Now().Add(-2 * cacheTouchInterval).Round(0)
+	assert.NoError(t, cache.put([]byte("recent"), &cacheEntry{Fingerprint: &Fingerprint{}, LastUsed: recent}))
+	assert.NoError(t, cache.put([]byte("stale"), &cacheEntry{Fingerprint: &Fingerprint{}, LastUsed: stale}))
+
+	for _, key := range []string{"recent", "stale"} {
+		fp, err := cache.get([]byte(key))
+		assert.NoError(t, err)
+		assert.NotNil(t, fp)
+	}
+
+	// hits on recently used entries don't write to the database
+	assert.True(t, lastUsed("recent").Equal(recent))
+	assert.True(t, lastUsed("stale").After(stale.Add(cacheTouchInterval)))
+}
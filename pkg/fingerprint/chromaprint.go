@@ -1,160 +1,368 @@
 package fingerprint
 
 import (
+	"bufio"
 	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"path"
 	"path/filepath"
-	"sync"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/spf13/afero"
 )
 
 var (
-	ValidAudioFormats = []string{".mp3"}
+	// ValidAudioFormats are the file extensions accepted by default. fpcalc decodes
+	// audio with ffmpeg, so the list covers the common formats ffmpeg supports
+	ValidAudioFormats = []string{
+		".mp3", ".flac", ".wav", ".ogg", ".oga", ".opus", ".m4a", ".mp4", ".aac", ".aif", ".aiff",
+	}
 )
 
+// stdinPath is the fpcalc input path used to read audio from stdin
+const stdinPath = "-"
+
 type ExecCmd = func(name string, arg ...string) *exec.Cmd
 
 // ChromaPrint is a concrete implementation of the Fingerprinter interface.
 // It manages IO operations using the chromaprint library, which must be installed
 // as external dependency
 type ChromaPrint struct {
-	execCmd ExecCmd
-	os      afero.Fs
+	execCmd     ExecCmd
+	fpcalcPath  string
+	version     FPcalcVersion
+	os          afero.Fs
+	formats     map[string]bool
+	walk        walkOptions
+	concurrency int
+	timeout     time.Duration
+	fpcalc      fpcalcOptions
+	archive     archiveLimits
+	progress    *ProgressTracker
 }
 
-func NewChromaPrint(exec ExecCmd, os afero.Fs) *ChromaPrint {
-	return &ChromaPrint{
-		execCmd: exec,
-		os:      os,
+// ChromaPrintOption configures optional ChromaPrint settings
+type ChromaPrintOption func(*ChromaPrint)
+
+// WithAudioFormats sets the file extensions ChromaPrint accepts, replacing
+// ValidAudioFormats. Files are accepted when their content matches one of the
+// formats, regardless of their name. Formats whose container isn't detected
+// from the content, e.g. .wma, .ape, .wv or .mka, are accepted by extension.
+// Extensions are matched case insensitively
+func WithAudioFormats(exts ...string) ChromaPrintOption {
+	return func(c *ChromaPrint) {
+		c.formats = formatsSet(exts)
 	}
 }
 
-// CalcFingerprint returns the audio Fingerprint of the file at fPath.
-// fPath can be a path to a directory or to a single file
-func (c *ChromaPrint) CalcFingerprint(fPath string) ([]*Fingerprint, error) {
-	fInfo, err := c.fileinfoFromPath(fPath)
-	if err != nil {
+// WithConcurrency sets the maximum number of files fingerprinted in parallel when
+// scanning a directory. It defaults to the number of CPUs
+func WithConcurrency(n int) ChromaPrintOption {
+	return func(c *ChromaPrint) {
+		c.concurrency = n
+	}
+}
+
+// WithFileTimeout sets the maximum time fpcalc can spend on a single file. The
+// fpcalc process is killed when the timeout expires and the file is reported
+// as a FailureTimeout. There is no timeout by default
+func WithFileTimeout(d time.Duration) ChromaPrintOption {
+	return func(c *ChromaPrint) {
+		c.timeout = d
+	}
+}
+
+// WithFPcalcPath sets the path of the fpcalc executable. By default fpcalc is
+// looked up in the directories named by the PATH environment variable
+func WithFPcalcPath(path string) ChromaPrintOption {
+	return func(c *ChromaPrint) {
+		c.fpcalcPath = path
+	}
+}
+
+// NewChromaPrint returns a ChromaPrint running fpcalc with exec. The fpcalc
+// executable is resolved and its version checked once, an *UnsupportedVersionError
+// is returned when it is older than MinFPcalcVersion
+func NewChromaPrint(exec ExecCmd, os afero.Fs, opts ...ChromaPrintOption) (*ChromaPrint, error) {
+	c := &ChromaPrint{
+		execCmd:     exec,
+		os:          os,
+		formats:     formatsSet(ValidAudioFormats),
+		concurrency: runtime.NumCPU(),
+		archive: archiveLimits{
+			maxEntries: DefaultArchiveMaxEntries,
+			maxBytes:   DefaultArchiveMaxBytes,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if err := c.resolveFPcalc(); err != nil {
 		return nil, err
 	}
 
-	if fInfo.IsDir() {
-		return c.scanAudioDir(fPath)
+	return c, nil
+}
+
+// Version returns the version of the fpcalc executable
+func (c *ChromaPrint) Version() FPcalcVersion {
+	return c.version
+}
+
+// optionsKey identifies the fpcalc version and options, which together with the
+// audio content determine the fingerprints
+func (c *ChromaPrint) optionsKey() string {
+	return c.version.String() + " " + strings.Join(c.fpcalc.flags(), " ")
+}
+
+// resolveFPcalc looks up the fpcalc executable, unless its path was set, and
+// checks its version
+func (c *ChromaPrint) resolveFPcalc() error {
+	if c.fpcalcPath == "" {
+		path, err := exec.LookPath("fpcalc")
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrFPcalcNotFound, err)
+		}
+		c.fpcalcPath = path
+	}
+
+	cmd := c.execCmd(c.fpcalcPath, "-version")
+	buf := new(bytes.Buffer)
+	cmd.Stdout = buf
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", ErrFPcalcNotFound, err)
+	}
+
+	version, err := parseFPcalcVersion(buf.String())
+	if err != nil {
+		return err
+	}
+
+	if version.less(MinFPcalcVersion) {
+		return &UnsupportedVersionError{Version: version, Min: MinFPcalcVersion}
 	}
+	c.version = version
+
+	return nil
+}
 
-	return c.fingerprintFromFile(fInfo, fPath)
+// CalcFingerprint returns the audio Fingerprint of the file at fPath.
+// fPath can be a path to a directory, to a zip or tar archive or to a single
+// file. When scanning a directory or an archive the files that can't be
+// fingerprinted are reported in the result Failures, while a single file
+// failure is returned as a *FileError. Archives found in directories are ignored
+func (c *ChromaPrint) CalcFingerprint(fPath string) (*BatchResult, error) {
+	return c.CalcFingerprintContext(context.Background(), fPath)
 }
 
-// result is the product of reading a file and extracting its adio fingerprint
-type result struct {
-	path   string
-	fprint *Fingerprint
-	err    error
+// CalcFingerprintContext is like CalcFingerprint but kills the running fpcalc
+// processes and returns when ctx is done
+func (c *ChromaPrint) CalcFingerprintContext(ctx context.Context, fPath string) (*BatchResult, error) {
+	return c.scan(ctx, fPath, c.fingerprintFile)
 }
 
-// scanAudioDir scans the directory at dirPath and concurrently extracts fingerprints.
-// Subdirectories and files with an invalid extension will be ignored.
-// This function only scans the top level directory
-func (c *ChromaPrint) scanAudioDir(dirPath string) ([]*Fingerprint, error) {
-	files, err := afero.ReadDir(c.os, dirPath)
+// scan fingerprints the audio files found at fPath with calc. The entries of
+// archives are streamed to fpcalc and are never passed to calc
+func (c *ChromaPrint) scan(ctx context.Context, fPath string, calc fileFingerprintFunc) (*BatchResult, error) {
+	fInfo, err := fileinfoFromPath(c.os, fPath)
 	if err != nil {
 		return nil, err
 	}
 
-	var wg sync.WaitGroup
-	fChan := make(chan result)
-	fings := []*Fingerprint{}
+	s := &scanner{
+		fs:          c.os,
+		walk:        c.walk,
+		concurrency: c.concurrency,
+		timeout:     c.timeout,
+		detect:      c.detectAudio,
+		calc:        calc,
+		isAudioName: c.isAudioName,
+		calcReader:  c.CalcFingerprintReader,
+		archive:     c.archive,
+		progress:    c.progress,
+	}
 
-	for _, fInfo := range files {
-		if fInfo.IsDir() || !isValidExtension(filepath.Ext(fInfo.Name())) {
-			continue
-		}
+	if fInfo.IsDir() {
+		return s.scanDir(ctx, fPath)
+	}
+
+	if isArchiveName(fInfo.Name()) {
+		return s.scanArchive(ctx, fPath)
+	}
+
+	return s.scanFile(ctx, fInfo, fPath)
+}
 
-		wg.Add(1)
-		go func(fInfo os.FileInfo) {
-			defer wg.Done()
+// detectAudio sniffs the content of the file at fPath and checks its container
+// matches one of the configured audio formats. The formats whose container
+// can't be sniffed, e.g. .wma or .ape, are accepted by extension instead and
+// have no Container
+func (c *ChromaPrint) detectAudio(fInfo os.FileInfo, fPath string) (Container, error) {
+	container, err := sniffContainer(c.os, fPath)
+	if err == ErrInvalidFormat && c.isUnsniffableFormat(fInfo.Name()) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
 
-			fpath := path.Join(dirPath, fInfo.Name())
-			fing, err := c.execFPcalc(fInfo, fpath)
+	return c.acceptContainer(container)
+}
 
-			fChan <- result{
-				path:   fpath,
-				fprint: fing,
-				err:    err,
+// isUnsniffableFormat reports whether the extension of name is a configured
+// format that isn't associated with any container sniffContainer detects
+func (c *ChromaPrint) isUnsniffableFormat(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if !c.formats[ext] {
+		return false
+	}
+
+	for _, exts := range containerExtensions {
+		for _, containerExt := range exts {
+			if containerExt == ext {
+				return false
 			}
-		}(fInfo)
+		}
 	}
 
-	go func() {
-		wg.Wait()
-		close(fChan)
-	}()
+	return true
+}
 
-	// collect results
-	for result := range fChan {
-		if result.err != nil {
-			return nil, result.err
+// acceptContainer checks the container matches one of the configured formats
+func (c *ChromaPrint) acceptContainer(container Container) (Container, error) {
+	for _, ext := range containerExtensions[container] {
+		if c.formats[ext] {
+			return container, nil
 		}
+	}
+
+	return "", ErrInvalidFormat
+}
 
-		fings = append(fings, result.fprint)
+func (c *ChromaPrint) fingerprintFile(ctx context.Context, f audioFile) (*Fingerprint, error) {
+	fing, err := c.execFPcalc(ctx, f.path, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	return fings, nil
+	fing.Container = f.container
+
+	return fing, nil
 }
 
-func (c *ChromaPrint) fingerprintFromFile(fInfo os.FileInfo, fPath string) ([]*Fingerprint, error) {
-	if !isValidExtension(filepath.Ext(fInfo.Name())) {
-		return nil, ErrInvalidFormat
+// CalcFingerprintReader returns the Fingerprint of the audio read from r, which
+// is piped to fpcalc. r is read until EOF to calculate the Fingerprint Source,
+// which has no Path. The audio must match one of the configured formats
+func (c *ChromaPrint) CalcFingerprintReader(ctx context.Context, r io.Reader) (*Fingerprint, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
 	}
 
-	fing, err := c.execFPcalc(fInfo, fPath)
+	src := newSourceReader(r)
+	br := bufio.NewReader(src)
+	container, err := sniffReader(br)
 	if err != nil {
 		return nil, err
 	}
 
-	return []*Fingerprint{fing}, nil
-}
+	if _, err := c.acceptContainer(container); err != nil {
+		return nil, err
+	}
 
-func (c *ChromaPrint) execFPcalc(fInfo os.FileInfo, fPath string) (*Fingerprint, error) {
-	fpcalcExecPath, err := exec.LookPath("fpcalc")
+	fing, err := c.execFPcalc(ctx, stdinPath, br)
 	if err != nil {
 		return nil, err
 	}
 
-	cmd := c.execCmd(fpcalcExecPath, "-json", fPath)
-	buf := new(bytes.Buffer)
-	cmd.Stdout = buf
-	err = cmd.Run()
+	fing.Container = container
+	fing.Source, err = src.source()
 	if err != nil {
 		return nil, err
 	}
 
-	var fp Fingerprint
-	if err := json.NewDecoder(buf).Decode(&fp); err != nil {
+	return fing, nil
+}
+
+// execFPcalc runs fpcalc on the file at fPath. When fPath is stdinPath the audio
+// is read from stdin
+func (c *ChromaPrint) execFPcalc(ctx context.Context, fPath string, stdin io.Reader) (*Fingerprint, error) {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	fp.InputFile = fInfo
+	cmd := c.execCmd(c.fpcalcPath, c.fpcalc.args(fPath)...)
+	buf := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	cmd.Stdin = stdin
+	cmd.Stdout = buf
+	cmd.Stderr = stderr
+	if err := runContext(ctx, cmd); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, newFPcalcError(fPath, stderr.String())
+		}
 
-	return &fp, nil
+		return nil, err
+	}
+
+	return c.fpcalc.parseOutput(buf)
 }
 
-func isValidExtension(ext string) bool {
-	for _, e := range ValidAudioFormats {
-		if e == ext {
-			return true
+// runContext runs cmd and kills its process when ctx is done. ExecCmd doesn't
+// accept a context, so exec.CommandContext can't be used. The ctx error is
+// returned when the process was killed
+func runContext(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan struct{})
+	defer close(exited)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			cmd.Process.Kill()
+		case <-exited:
+		}
+	}()
+
+	if err := cmd.Wait(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
 		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (c *ChromaPrint) isAudioName(name string) bool {
+	return c.formats[strings.ToLower(filepath.Ext(name))]
+}
+
+func formatsSet(exts []string) map[string]bool {
+	formats := make(map[string]bool, len(exts))
+	for _, ext := range exts {
+		formats[strings.ToLower(ext)] = true
 	}
 
-	return false
+	return formats
 }
 
-func (c *ChromaPrint) fileinfoFromPath(p string) (os.FileInfo, error) {
-	fInfo, err := c.os.Stat(p)
+func fileinfoFromPath(fs afero.Fs, p string) (os.FileInfo, error) {
+	fInfo, err := fs.Stat(p)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil, ErrInvalidPath
@@ -1,14 +1,23 @@
 package fingerprint
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/ocramh/fingerprinter/pkg/fingerprint/fingerprinttest"
 )
 
 const (
@@ -19,37 +28,42 @@ const (
 )
 
 var (
-	mockExec = func(command string, args ...string) *exec.Cmd {
-		cs := []string{"-test.run=TestShellProcessSuccess", "--", command}
-		cs = append(cs, args...)
-		cmd := exec.Command(os.Args[0], cs...)
-		cmd.Env = []string{"GO_TEST_PROCESS=1"}
-		return cmd
-	}
-
-	mockFailExec = func(command string, args ...string) *exec.Cmd {
-		cs := []string{"-test.run=TestShellProcessError", "--", command}
-		cs = append(cs, args...)
-		cmd := exec.Command(os.Args[0], cs...)
-		cmd.Env = []string{"GO_TEST_PROCESS=1"}
-		return cmd
-	}
+	// mp3Header is an MPEG-1 Layer III frame header
+	mp3Header = []byte{0xff, 0xfb, 0x90, 0x64}
 )
 
-func TestShellProcessSuccess(t *testing.T) {
-	if os.Getenv("GO_TEST_PROCESS") != "1" {
-		return
-	}
-	// Print out the test value to stdout
-	fmt.Fprintf(os.Stdout, `{"duration": 10.5, "fingerprint": "the-fingerprint"}`)
-	os.Exit(0)
+func TestMain(m *testing.M) {
+	fingerprinttest.Main()
+	os.Exit(m.Run())
+}
+
+// mockExec returns a fake fpcalc fingerprinting every file successfully
+func mockExec(t *testing.T) ExecCmd {
+	return fingerprinttest.NewFPcalc(t).ExecCmd
+}
+
+// mockFailExec returns a fake fpcalc failing every file
+func mockFailExec(t *testing.T) ExecCmd {
+	fpcalc := fingerprinttest.NewFPcalc(t)
+	fpcalc.Default = fingerprinttest.Response{ExitCode: 2}
+	return fpcalc.ExecCmd
+}
+
+// mockHangExec returns a fake fpcalc that doesn't exit until it is killed
+func mockHangExec(t *testing.T) ExecCmd {
+	fpcalc := fingerprinttest.NewFPcalc(t)
+	fpcalc.Default.Delay = time.Minute
+	return fpcalc.ExecCmd
 }
 
-func TestShellProcessError(t *testing.T) {
-	if os.Getenv("GO_TEST_PROCESS") != "1" {
-		return
+// mustNewChromaPrint returns a ChromaPrint running the fpcalc mock exec
+func mustNewChromaPrint(exec ExecCmd, fs afero.Fs, opts ...ChromaPrintOption) *ChromaPrint {
+	chromap, err := NewChromaPrint(exec, fs, append([]ChromaPrintOption{WithFPcalcPath("fpcalc")}, opts...)...)
+	if err != nil {
+		panic(err)
 	}
-	os.Exit(2)
+
+	return chromap
 }
 
 func mustSetupFS() afero.Fs {
@@ -60,13 +74,13 @@ func mustSetupFS() afero.Fs {
 	}
 
 	inputFile1Path := path.Join(testDataDir, testFile1)
-	err = afero.WriteFile(mockFS, inputFile1Path, []byte("file 1"), 0644)
+	err = afero.WriteFile(mockFS, inputFile1Path, append(mp3Header, []byte("file 1")...), 0644)
 	if err != nil {
 		panic(err)
 	}
 
 	inputFile2Path := path.Join(testDataDir, testFile2)
-	err = afero.WriteFile(mockFS, inputFile2Path, []byte("file 2"), 0644)
+	err = afero.WriteFile(mockFS, inputFile2Path, append(mp3Header, []byte("file 2")...), 0644)
 	if err != nil {
 		panic(err)
 	}
@@ -80,57 +94,146 @@ func mustSetupFS() afero.Fs {
 	return mockFS
 }
 
+// mustSource returns the expected Source of the file at fPath
+func mustSource(fs afero.Fs, fPath string) *Source {
+	info, err := fs.Stat(fPath)
+	if err != nil {
+		panic(err)
+	}
+
+	content, err := afero.ReadFile(fs, fPath)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Source{
+		Path:    fPath,
+		Size:    int64(len(content)),
+		ModTime: info.ModTime().UTC(),
+		Hash:    fmt.Sprintf("%x", sha256.Sum256(content)),
+	}
+}
+
 func TestFingerprintFromFile(t *testing.T) {
 	mockFS := mustSetupFS()
 
-	chromap := NewChromaPrint(mockExec, mockFS)
+	chromap := mustNewChromaPrint(mockExec(t), mockFS)
 	inputFile := path.Join(testDataDir, testFile1)
-	fInfo, err := mockFS.Stat(inputFile)
-	assert.NoError(t, err)
 
 	got, err := chromap.CalcFingerprint(inputFile)
 	assert.NoError(t, err)
-	assert.Len(t, got, 1)
-	assert.Equal(t, got[0], &Fingerprint{
+	assert.Len(t, got.Fingerprints, 1)
+	assert.Empty(t, got.Failures)
+	assert.Equal(t, got.Fingerprints[0], &Fingerprint{
 		Duration:  10.5,
 		Value:     "the-fingerprint",
-		InputFile: fInfo,
+		Container: ContainerMP3,
+		RelPath:   testFile1,
+		Source:    mustSource(mockFS, inputFile),
 	})
 }
 
 func TestFingerprintFromDir(t *testing.T) {
 	mockFS := mustSetupFS()
 
-	chromap := NewChromaPrint(mockExec, mockFS)
+	chromap := mustNewChromaPrint(mockExec(t), mockFS)
 
 	got, err := chromap.CalcFingerprint(testDataDir)
 	assert.NoError(t, err)
-	assert.Len(t, got, 2)
-
-	fInfo1, err := mockFS.Stat(path.Join(testDataDir, testFile1))
-	assert.NoError(t, err)
-
-	fInfo2, err := mockFS.Stat(path.Join(testDataDir, testFile2))
-	assert.NoError(t, err)
+	assert.Len(t, got.Fingerprints, 2)
+	assert.Empty(t, got.Failures)
 
 	assert.ElementsMatch(t, []*Fingerprint{
 		{
 			Duration:  10.5,
 			Value:     "the-fingerprint",
-			InputFile: fInfo1,
+			Container: ContainerMP3,
+			RelPath:   testFile1,
+			Source:    mustSource(mockFS, path.Join(testDataDir, testFile1)),
 		},
 		{
 			Duration:  10.5,
 			Value:     "the-fingerprint",
-			InputFile: fInfo2,
+			Container: ContainerMP3,
+			RelPath:   testFile2,
+			Source:    mustSource(mockFS, path.Join(testDataDir, testFile2)),
+		},
+	}, got.Fingerprints)
+}
+
+func TestFingerprintJSONRoundTrip(t *testing.T) {
+	mockFS := mustSetupFS()
+
+	chromap := mustNewChromaPrint(mockExec(t), mockFS)
+	got, err := chromap.CalcFingerprint(path.Join(testDataDir, testFile1))
+	assert.NoError(t, err)
+
+	b, err := json.Marshal(got.Fingerprints[0])
+	assert.NoError(t, err)
+
+	var reloaded Fingerprint
+	assert.NoError(t, json.Unmarshal(b, &reloaded))
+	assert.Equal(t, got.Fingerprints[0], &reloaded)
+}
+
+func TestFingerprintPath(t *testing.T) {
+	assert.Equal(t, "track.mp3", (&Fingerprint{RelPath: "track.mp3"}).Path())
+	assert.Equal(t, "track.mp3", (&Fingerprint{RelPath: "track.mp3", Source: &Source{}}).Path())
+	assert.Equal(t, "/audio/track.mp3", (&Fingerprint{RelPath: "track.mp3", Source: &Source{Path: "/audio/track.mp3"}}).Path())
+	assert.Equal(t, "/audio/album.zip!/cd1/track.mp3", (&Fingerprint{RelPath: "cd1/track.mp3", Source: &Source{Path: "/audio/album.zip", Entry: "cd1/track.mp3"}}).Path())
+}
+
+func TestCalcFingerprintReader(t *testing.T) {
+	content := append(mp3Header, bytes.Repeat([]byte("audio"), 100000)...)
+
+	fpcalc := fingerprinttest.NewFPcalc(t)
+	chromap := mustNewChromaPrint(fpcalc.ExecCmd, mustSetupFS())
+	got, err := chromap.CalcFingerprintReader(context.Background(), bytes.NewReader(content))
+	assert.NoError(t, err)
+	assert.Equal(t, &Fingerprint{
+		Duration:  fingerprinttest.DefaultDuration,
+		Value:     fingerprinttest.DefaultFingerprint,
+		Container: ContainerMP3,
+		Source: &Source{
+			Size: int64(len(content)),
+			Hash: fmt.Sprintf("%x", sha256.Sum256(content)),
 		},
 	}, got)
+
+	calls := fpcalc.Calls()
+	assert.Equal(t, []string{"-"}, fpcalc.Paths())
+	assert.Equal(t, content, calls[len(calls)-1].Stdin())
+}
+
+func TestCalcFingerprintReaderPartialRead(t *testing.T) {
+	// fpcalc exits without reading the whole stream
+	content := append(mp3Header, bytes.Repeat([]byte("audio"), 100000)...)
+
+	fpcalc := fingerprinttest.NewFPcalc(t)
+	fpcalc.Default.StdinLimit = 10
+	chromap := mustNewChromaPrint(fpcalc.ExecCmd, mustSetupFS())
+	got, err := chromap.CalcFingerprintReader(context.Background(), bytes.NewReader(content))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), got.Source.Size)
+	assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256(content)), got.Source.Hash)
+}
+
+func TestCalcFingerprintReaderErrors(t *testing.T) {
+	chromap := mustNewChromaPrint(mockExec(t), mustSetupFS())
+	_, err := chromap.CalcFingerprintReader(context.Background(), strings.NewReader("text"))
+	assert.Equal(t, ErrInvalidFormat, err)
+
+	chromap = mustNewChromaPrint(mockFailExec(t), mustSetupFS())
+	_, err = chromap.CalcFingerprintReader(context.Background(), bytes.NewReader(mp3Header))
+	var fpcalcErr *FPcalcError
+	assert.True(t, errors.As(err, &fpcalcErr))
+	assert.Equal(t, "-", fpcalcErr.Path)
 }
 
 func TestInputErrors(t *testing.T) {
 	mockFS := mustSetupFS()
 
-	chromap := NewChromaPrint(mockExec, mockFS)
+	chromap := mustNewChromaPrint(mockExec(t), mockFS)
 
 	testcases := []struct {
 		name        string
@@ -160,7 +263,198 @@ func TestInputErrors(t *testing.T) {
 func TestHandleExecCmdError(t *testing.T) {
 	mockFS := mustSetupFS()
 
-	chromap := NewChromaPrint(mockFailExec, mockFS)
-	_, err := chromap.CalcFingerprint(testDataDir)
-	assert.NotNil(t, err)
+	chromap := mustNewChromaPrint(mockFailExec(t), mockFS)
+	_, err := chromap.CalcFingerprint(path.Join(testDataDir, testFile1))
+	var fileErr *FileError
+	assert.True(t, errors.As(err, &fileErr))
+	assert.Equal(t, FailureDecode, fileErr.Kind)
+	assert.Equal(t, path.Join(testDataDir, testFile1), fileErr.Path)
+}
+
+func TestExecCmdStderr(t *testing.T) {
+	mockFS := mustSetupFS()
+	inputFile := path.Join(testDataDir, testFile1)
+
+	fpcalc := fingerprinttest.NewFPcalc(t).OnFile(inputFile, fingerprinttest.Response{
+		Stderr:   "ERROR: Could not find any audio stream in the file\n",
+		ExitCode: 2,
+	})
+
+	chromap := mustNewChromaPrint(fpcalc.ExecCmd, mockFS)
+	_, err := chromap.CalcFingerprint(inputFile)
+
+	var fpcalcErr *FPcalcError
+	assert.True(t, errors.As(err, &fpcalcErr))
+	assert.Equal(t, inputFile, fpcalcErr.Path)
+	assert.Equal(t, "Could not find any audio stream in the file", fpcalcErr.Message)
+	assert.True(t, errors.Is(err, ErrNoAudioStream))
+
+	var fileErr *FileError
+	assert.True(t, errors.As(err, &fileErr))
+	assert.Equal(t, FailureUnsupportedFormat, fileErr.Kind)
+}
+
+func TestPartialDirFailure(t *testing.T) {
+	mockFS := mustSetupFS()
+	corruptFile := path.Join(testDataDir, "corrupt.mp3")
+	err := afero.WriteFile(mockFS, corruptFile, []byte("not an mp3"), 0644)
+	assert.NoError(t, err)
+
+	chromap := mustNewChromaPrint(mockExec(t), mockFS)
+	got, err := chromap.CalcFingerprint(testDataDir)
+	assert.NoError(t, err)
+	assert.Len(t, got.Fingerprints, 2)
+	assert.Len(t, got.Failures, 1)
+	assert.Equal(t, corruptFile, got.Failures[0].Path)
+	assert.Equal(t, "corrupt.mp3", got.Failures[0].RelPath)
+	assert.Equal(t, FailureUnsupportedFormat, got.Failures[0].Kind)
+	assert.True(t, errors.Is(got.Failures[0], ErrInvalidFormat))
+}
+
+func TestDirExecCmdErrors(t *testing.T) {
+	mockFS := mustSetupFS()
+
+	chromap := mustNewChromaPrint(mockFailExec(t), mockFS)
+	got, err := chromap.CalcFingerprint(testDataDir)
+	assert.NoError(t, err)
+	assert.Empty(t, got.Fingerprints)
+	assert.Len(t, got.Failures, 2)
+	for _, failure := range got.Failures {
+		assert.Equal(t, FailureDecode, failure.Kind)
+	}
+}
+
+func TestFileTimeout(t *testing.T) {
+	mockFS := mustSetupFS()
+
+	chromap := mustNewChromaPrint(mockHangExec(t), mockFS, WithFileTimeout(100*time.Millisecond))
+	start := time.Now()
+	got, err := chromap.CalcFingerprint(testDataDir)
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < 30*time.Second, "fpcalc processes weren't killed")
+	assert.Empty(t, got.Fingerprints)
+	assert.Len(t, got.Failures, 2)
+	for _, failure := range got.Failures {
+		assert.Equal(t, FailureTimeout, failure.Kind)
+	}
+}
+
+func TestCalcFingerprintContextCancel(t *testing.T) {
+	mockFS := mustSetupFS()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	chromap := mustNewChromaPrint(mockHangExec(t), mockFS)
+	start := time.Now()
+	got, err := chromap.CalcFingerprintContext(ctx, testDataDir)
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, time.Since(start) < 30*time.Second, "fpcalc processes weren't killed")
+	assert.Empty(t, got.Fingerprints)
+}
+
+func TestRawFingerprint(t *testing.T) {
+	mockFS := mustSetupFS()
+
+	fpcalc := fingerprinttest.NewFPcalc(t)
+	chromap := mustNewChromaPrint(fpcalc.ExecCmd, mockFS, WithRawFingerprint())
+	got, err := chromap.CalcFingerprint(path.Join(testDataDir, testFile1))
+	assert.NoError(t, err)
+	assert.Contains(t, fpcalc.Calls()[1].Args, "-raw")
+	assert.Len(t, got.Fingerprints, 1)
+	assert.Equal(t, fingerprinttest.DefaultRaw, got.Fingerprints[0].Raw)
+	assert.Equal(t, float32(fingerprinttest.DefaultDuration), got.Fingerprints[0].Duration)
+
+	// the compressed value is encoded from the raw one
+	raw, err := (&Fingerprint{Value: got.Fingerprints[0].Value}).RawValues()
+	assert.NoError(t, err)
+	assert.Equal(t, fingerprinttest.DefaultRaw, raw)
+}
+
+func TestChunkedFingerprint(t *testing.T) {
+	mockFS := mustSetupFS()
+
+	fpcalc := fingerprinttest.NewFPcalc(t)
+	chromap := mustNewChromaPrint(fpcalc.ExecCmd, mockFS, WithChunks(4*time.Second, false))
+	got, err := chromap.CalcFingerprint(path.Join(testDataDir, testFile1))
+	assert.NoError(t, err)
+	assert.Len(t, got.Fingerprints, 1)
+	assert.Empty(t, got.Fingerprints[0].Value)
+	assert.Equal(t, float32(fingerprinttest.DefaultDuration), got.Fingerprints[0].Duration)
+	assert.Equal(t, []Segment{
+		{Timestamp: 0, Duration: 4, Value: fingerprinttest.DefaultFingerprint},
+		{Timestamp: 4, Duration: 4, Value: fingerprinttest.DefaultFingerprint},
+		{Timestamp: 8, Duration: 2.5, Value: fingerprinttest.DefaultFingerprint},
+	}, got.Fingerprints[0].Segments)
+}
+
+func TestFingerprintRawValues(t *testing.T) {
+	raw, err := (&Fingerprint{Value: "AQAAAQE"}).RawValues()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{1}, raw)
+
+	raw, err = (&Fingerprint{Value: "AQAAAQE", Raw: []uint32{2}}).RawValues()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{2}, raw)
+
+	_, err = (&Fingerprint{Value: "the-fingerprint"}).RawValues()
+	assert.Error(t, err)
+}
+
+func TestFPcalcVersion(t *testing.T) {
+	chromap := mustNewChromaPrint(mockExec(t), mustSetupFS())
+	assert.Equal(t, FPcalcVersion{Major: 1, Minor: 5, Patch: 1}, chromap.Version())
+}
+
+func TestFPcalcNotFound(t *testing.T) {
+	_, err := NewChromaPrint(exec.Command, mustSetupFS(), WithFPcalcPath("/non/existent/fpcalc"))
+	assert.True(t, errors.Is(err, ErrFPcalcNotFound))
+}
+
+func TestAudioFormats(t *testing.T) {
+	testcases := []struct {
+		name        string
+		opts        []ChromaPrintOption
+		file        string
+		content     []byte
+		expected    Container
+		expectedErr error
+	}{
+		{name: "default mp3", content: mp3Header, expected: ContainerMP3},
+		{name: "default flac", content: []byte("fLaC\x00\x00\x00\x22"), expected: ContainerFLAC},
+		{name: "unknown content", content: []byte("text file"), expectedErr: ErrInvalidFormat},
+		{name: "custom formats", opts: []ChromaPrintOption{WithAudioFormats(".FLAC")}, content: []byte("fLaC"), expected: ContainerFLAC},
+		{name: "custom formats exclude defaults", opts: []ChromaPrintOption{WithAudioFormats(".flac")}, content: mp3Header, expectedErr: ErrInvalidFormat},
+		{name: "any container extension", opts: []ChromaPrintOption{WithAudioFormats(".opus")}, content: []byte("OggS"), expected: ContainerOgg},
+		{name: "unsniffable format by extension", opts: []ChromaPrintOption{WithAudioFormats(".WMA")}, file: "/audio.wma", content: []byte("0&\xb2\x75\x8e\x66\xcf\x11")},
+		{name: "unsniffable format other extension", opts: []ChromaPrintOption{WithAudioFormats(".wma")}, file: "/audio.ape", content: []byte("MAC "), expectedErr: ErrInvalidFormat},
+		{name: "sniffable format by extension only", opts: []ChromaPrintOption{WithAudioFormats(".mp3")}, file: "/audio.mp3", content: []byte("text file"), expectedErr: ErrInvalidFormat},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			file := testcase.file
+			if file == "" {
+				file = "/audio"
+			}
+
+			mockFS := afero.NewMemMapFs()
+			assert.NoError(t, afero.WriteFile(mockFS, file, testcase.content, 0644))
+
+			chromap := mustNewChromaPrint(mockExec(t), mockFS, testcase.opts...)
+			fInfo, err := mockFS.Stat(file)
+			assert.NoError(t, err)
+
+			got, err := chromap.detectAudio(fInfo, file)
+			assert.Equal(t, testcase.expectedErr, err)
+			assert.Equal(t, testcase.expected, got)
+		})
+	}
+}
+
+func TestCustomAudioFormatsRejectFile(t *testing.T) {
+	mockFS := mustSetupFS()
+
+	chromap := mustNewChromaPrint(mockExec(t), mockFS, WithAudioFormats(".flac"))
+	_, err := chromap.CalcFingerprint(path.Join(testDataDir, testFile1))
+	assert.Equal(t, ErrInvalidFormat, err)
 }
@@ -0,0 +1,101 @@
+package fingerprint
+
+import (
+	"sort"
+
+	"github.com/ocramh/fingerprinter/pkg/chromaprint"
+)
+
+const (
+	// DefaultClipMaxBitErrorRate is the highest bit error rate of the clip
+	// positions reported as matches by FindClip
+	DefaultClipMaxBitErrorRate = 0.35
+)
+
+// ClipMatch is a position of a recording where a clip was found
+type ClipMatch struct {
+	// Offset is the index of the recording sub-fingerprint where the clip starts
+	Offset int `json:"offset"`
+	// OffsetSeconds is Offset converted to seconds
+	OffsetSeconds float64 `json:"offset_seconds"`
+	// Confidence goes from 0 to 1 and is the similarity score of the clip with
+	// the matching part of the recording
+	Confidence   float64 `json:"confidence"`
+	BitErrorRate float64 `json:"bit_error_rate"`
+}
+
+// FindClip returns the positions where the clip fingerprint occurs in the longer
+// recording fingerprint, sorted by offset. Positions are matches when the bit
+// error rate of the clip aligned with the recording is at most maxBitErrorRate
+func FindClip(recording, clip *Fingerprint, maxBitErrorRate float64) ([]ClipMatch, error) {
+	rawRecording, err := recording.RawValues()
+	if err != nil {
+		return nil, err
+	}
+
+	rawClip, err := clip.RawValues()
+	if err != nil {
+		return nil, err
+	}
+
+	return FindClipRaw(rawRecording, rawClip, maxBitErrorRate)
+}
+
+// FindClipRaw is like FindClip for raw fingerprints
+func FindClipRaw(recording, clip []uint32, maxBitErrorRate float64) ([]ClipMatch, error) {
+	if len(recording) == 0 || len(clip) == 0 {
+		return nil, ErrEmptyFingerprint
+	}
+
+	if len(clip) > len(recording) {
+		return nil, ErrClipTooLong
+	}
+
+	var candidates []ClipMatch
+	for offset := 0; offset <= len(recording)-len(clip); offset++ {
+		ber, _ := bitErrorRate(recording, clip, offset)
+		if ber <= maxBitErrorRate {
+			candidates = append(candidates, ClipMatch{Offset: offset, BitErrorRate: ber})
+		}
+	}
+
+	// the positions next to a match have a low bit error rate too, so only the
+	// best position of each group of overlapping candidates is kept
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].BitErrorRate < candidates[j].BitErrorRate
+	})
+
+	minDistance := (len(clip) + 1) / 2
+	matches := []ClipMatch{}
+	for _, candidate := range candidates {
+		if nearMatch(matches, candidate.Offset, minDistance) {
+			continue
+		}
+
+		candidate.OffsetSeconds = float64(candidate.Offset) * chromaprint.ItemDuration
+		candidate.Confidence = similarityScore(candidate.BitErrorRate)
+		matches = append(matches, candidate)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Offset < matches[j].Offset
+	})
+
+	return matches, nil
+}
+
+// nearMatch reports whether offset is closer than minDistance to one of matches
+func nearMatch(matches []ClipMatch, offset int, minDistance int) bool {
+	for _, m := range matches {
+		distance := m.Offset - offset
+		if distance < 0 {
+			distance = -distance
+		}
+
+		if distance < minDistance {
+			return true
+		}
+	}
+
+	return false
+}
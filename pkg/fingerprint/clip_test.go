@@ -0,0 +1,94 @@
+package fingerprint
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ocramh/fingerprinter/pkg/chromaprint"
+)
+
+// flipBits returns a copy of raw where each bit is flipped with probability p
+func flipBits(rnd *rand.Rand, raw []uint32, p float64) []uint32 {
+	out := make([]uint32, len(raw))
+	for i, v := range raw {
+		for b := uint(0); b < 32; b++ {
+			if rnd.Float64() < p {
+				v ^= 1 << b
+			}
+		}
+		out[i] = v
+	}
+
+	return out
+}
+
+func TestFindClipRaw(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	recording := randomRaw(rnd, 500)
+	clip := flipBits(rnd, recording[100:160], 0.1)
+
+	// the clip occurs a second time later in the recording
+	copy(recording[320:], recording[100:160])
+
+	got, err := FindClipRaw(recording, clip, DefaultClipMaxBitErrorRate)
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+	assert.Equal(t, 100, got[0].Offset)
+	assert.Equal(t, 320, got[1].Offset)
+	for _, match := range got {
+		assert.InDelta(t, 0.8, match.Confidence, 0.1)
+		assert.Equal(t, float64(match.Offset)*chromaprint.ItemDuration, match.OffsetSeconds)
+	}
+}
+
+func TestFindClipRawNoMatch(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	got, err := FindClipRaw(randomRaw(rnd, 500), randomRaw(rnd, 60), DefaultClipMaxBitErrorRate)
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestFindClipRawErrors(t *testing.T) {
+	_, err := FindClipRaw([]uint32{1}, nil, DefaultClipMaxBitErrorRate)
+	assert.Equal(t, ErrEmptyFingerprint, err)
+
+	_, err = FindClipRaw([]uint32{1}, []uint32{1, 2}, DefaultClipMaxBitErrorRate)
+	assert.Equal(t, ErrClipTooLong, err)
+}
+
+func TestFindClipInAudio(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	// a minute of random notes, half a second each
+	samples := make([]int16, 60*chromaprint.SampleRate)
+	var freq float64
+	for i := range samples {
+		if i%(chromaprint.SampleRate/2) == 0 {
+			freq = 110 * math.Pow(2, float64(rnd.Intn(48))/12)
+		}
+		samples[i] = int16(8000 * math.Sin(2*math.Pi*freq*float64(i)/chromaprint.SampleRate))
+	}
+
+	recording, err := chromaprint.Fingerprint(samples, chromaprint.SampleRate, 1)
+	assert.NoError(t, err)
+
+	// a 20 seconds clip starting at the beginning of the 200th frame
+	start := 200 * 1365
+	clip, err := chromaprint.Fingerprint(samples[start:start+20*chromaprint.SampleRate], chromaprint.SampleRate, 1)
+	assert.NoError(t, err)
+
+	got, err := FindClip(
+		&Fingerprint{Value: chromaprint.EncodeFingerprint(recording, chromaprint.AlgorithmTest2)},
+		&Fingerprint{Raw: clip},
+		DefaultClipMaxBitErrorRate,
+	)
+	assert.NoError(t, err)
+	assert.Len(t, got, 1)
+	assert.Equal(t, 200, got[0].Offset)
+	assert.InDelta(t, 200*chromaprint.ItemDuration, got[0].OffsetSeconds, 1e-9)
+	assert.True(t, got[0].Confidence > 0.9, "confidence %f", got[0].Confidence)
+}
@@ -0,0 +1,120 @@
+package fingerprint
+
+import (
+	"math/bits"
+
+	"github.com/ocramh/fingerprinter/pkg/chromaprint"
+)
+
+// Similarity is the result of comparing two fingerprints
+type Similarity struct {
+	// Score goes from 0, for unrelated audio, to 1 for identical fingerprints
+	Score float64 `json:"score"`
+	// BitErrorRate is the fraction of different bits in the aligned
+	// sub-fingerprints. Unrelated audio has a bit error rate close to 0.5
+	BitErrorRate float64 `json:"bit_error_rate"`
+	// Offset is the number of sub-fingerprints the second fingerprint is shifted
+	// by to align with the first one. A positive offset means the second
+	// fingerprint matches the first one starting from its Offset-th value
+	Offset int `json:"offset"`
+	// OffsetSeconds is Offset converted to seconds
+	OffsetSeconds float64 `json:"offset_seconds"`
+	// Overlap is the number of aligned sub-fingerprints
+	Overlap int `json:"overlap"`
+}
+
+// Compare returns the similarity of the a and b fingerprints at the time offset
+// where they match best. The raw values are decoded from the compressed
+// fingerprints when not available
+func Compare(a, b *Fingerprint) (*Similarity, error) {
+	rawA, err := a.RawValues()
+	if err != nil {
+		return nil, err
+	}
+
+	rawB, err := b.RawValues()
+	if err != nil {
+		return nil, err
+	}
+
+	return CompareRaw(rawA, rawB)
+}
+
+// CompareRaw is like Compare for raw fingerprints. Offsets are only considered
+// when the fingerprints overlap for at least half of the shortest one
+func CompareRaw(a, b []uint32) (*Similarity, error) {
+	if len(a) == 0 || len(b) == 0 {
+		return nil, ErrEmptyFingerprint
+	}
+
+	shortest := len(a)
+	if len(b) < shortest {
+		shortest = len(b)
+	}
+
+	minOverlap := (shortest + 1) / 2
+
+	return bestAlignment(a, b, minOverlap, -(len(b) - minOverlap), len(a)-minOverlap), nil
+}
+
+// bestAlignment returns the Similarity of a and b at the offset, between
+// minOffset and maxOffset, with the lowest bit error rate. Offsets where the
+// fingerprints overlap for less than minOverlap values are skipped
+func bestAlignment(a, b []uint32, minOverlap int, minOffset int, maxOffset int) *Similarity {
+	best := &Similarity{BitErrorRate: 1}
+
+	for offset := minOffset; offset <= maxOffset; offset++ {
+		ber, overlap := bitErrorRate(a, b, offset)
+		if overlap < minOverlap || overlap <= 0 {
+			continue
+		}
+
+		if ber < best.BitErrorRate {
+			best.BitErrorRate = ber
+			best.Offset = offset
+			best.Overlap = overlap
+		}
+	}
+
+	best.OffsetSeconds = float64(best.Offset) * chromaprint.ItemDuration
+	best.Score = similarityScore(best.BitErrorRate)
+
+	return best
+}
+
+// similarityScore maps a bit error rate to a score going from 0, for the 0.5 bit
+// error rate of unrelated fingerprints, to 1
+func similarityScore(ber float64) float64 {
+	score := 1 - 2*ber
+	if score < 0 {
+		return 0
+	}
+
+	return score
+}
+
+// bitErrorRate returns the fraction of different bits between b and a, when
+// a[offset+i] is aligned with b[i], and the number of aligned values
+func bitErrorRate(a, b []uint32, offset int) (float64, int) {
+	startB := 0
+	if offset < 0 {
+		startB = -offset
+	}
+
+	endB := len(b)
+	if len(a)-offset < endB {
+		endB = len(a) - offset
+	}
+
+	overlap := endB - startB
+	if overlap <= 0 {
+		return 1, 0
+	}
+
+	var errs int
+	for i := startB; i < endB; i++ {
+		errs += bits.OnesCount32(a[offset+i] ^ b[i])
+	}
+
+	return float64(errs) / float64(32*overlap), overlap
+}
@@ -0,0 +1,76 @@
+package fingerprint
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ocramh/fingerprinter/pkg/chromaprint"
+)
+
+func randomRaw(rnd *rand.Rand, n int) []uint32 {
+	raw := make([]uint32, n)
+	for i := range raw {
+		raw[i] = rnd.Uint32()
+	}
+
+	return raw
+}
+
+func TestCompareRaw(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	a := randomRaw(rnd, 200)
+
+	testcases := []struct {
+		name           string
+		b              []uint32
+		expectedOffset int
+		expectedScore  float64
+	}{
+		{name: "identical", b: a, expectedOffset: 0, expectedScore: 1},
+		{name: "second starts later", b: a[20:], expectedOffset: 20, expectedScore: 1},
+		{name: "second starts earlier", b: append(randomRaw(rnd, 15), a...), expectedOffset: -15, expectedScore: 1},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			got, err := CompareRaw(a, testcase.b)
+			assert.NoError(t, err)
+			assert.Equal(t, testcase.expectedOffset, got.Offset)
+			assert.Equal(t, testcase.expectedScore, got.Score)
+			assert.Equal(t, float64(testcase.expectedOffset)*chromaprint.ItemDuration, got.OffsetSeconds)
+		})
+	}
+}
+
+func TestCompareRawUnrelated(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	got, err := CompareRaw(randomRaw(rnd, 200), randomRaw(rnd, 200))
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.5, got.BitErrorRate, 0.05)
+	assert.True(t, got.Score < 0.1, "score %f", got.Score)
+	assert.True(t, got.Overlap >= 100, "overlap %d", got.Overlap)
+}
+
+func TestCompareRawEmpty(t *testing.T) {
+	_, err := CompareRaw(nil, []uint32{1})
+	assert.Equal(t, ErrEmptyFingerprint, err)
+}
+
+func TestCompare(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	raw := randomRaw(rnd, 100)
+
+	a := &Fingerprint{Value: chromaprint.EncodeFingerprint(raw, chromaprint.AlgorithmTest2)}
+	b := &Fingerprint{Raw: raw[10:]}
+
+	got, err := Compare(a, b)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, got.Offset)
+	assert.Equal(t, float64(1), got.Score)
+
+	_, err = Compare(a, &Fingerprint{Value: "the-fingerprint"})
+	assert.Error(t, err)
+}
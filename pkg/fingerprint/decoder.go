@@ -0,0 +1,132 @@
+package fingerprint
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+var (
+	ErrInvalidWAV = errors.New("invalid wav stream")
+)
+
+// Decoder decodes an audio stream into PCM samples
+type Decoder interface {
+	Decode(r io.Reader) (*PCM, error)
+}
+
+// PCM is a buffer of decoded audio. Samples of multichannel audio are interleaved
+type PCM struct {
+	SampleRate int
+	Channels   int
+	Samples    []int16
+}
+
+// WAVDecoder is a Decoder for RIFF/WAVE files containing integer PCM data
+type WAVDecoder struct{}
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+// wavSubFormatGUID is the GUID of the WAVE_FORMAT_EXTENSIBLE sub-formats, where
+// the first two bytes are replaced by the format code
+var wavSubFormatGUID = []byte{0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
+
+// Decode implements the Decoder interface
+func (WAVDecoder) Decode(r io.Reader) (*PCM, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) < 12 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		return nil, ErrInvalidWAV
+	}
+
+	var pcm *PCM
+	var bitsPerSample int
+	for chunks := b[12:]; len(chunks) >= 8; {
+		id := string(chunks[0:4])
+		size := int(binary.LittleEndian.Uint32(chunks[4:8]))
+		chunks = chunks[8:]
+		if size > len(chunks) {
+			size = len(chunks)
+		}
+		data := chunks[:size]
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, ErrInvalidWAV
+			}
+
+			format := binary.LittleEndian.Uint16(data[0:2])
+			if format == wavFormatExtensible {
+				// the actual format is the sub-format of the extension
+				if size < 40 || !bytes.Equal(data[26:40], wavSubFormatGUID) {
+					return nil, ErrInvalidFormat
+				}
+				format = binary.LittleEndian.Uint16(data[24:26])
+			}
+
+			// floating point samples, like the other formats, aren't supported
+			if format != wavFormatPCM {
+				return nil, ErrInvalidFormat
+			}
+
+			pcm = &PCM{
+				Channels:   int(binary.LittleEndian.Uint16(data[2:4])),
+				SampleRate: int(binary.LittleEndian.Uint32(data[4:8])),
+			}
+			bitsPerSample = int(binary.LittleEndian.Uint16(data[14:16]))
+		case "data":
+			if pcm == nil {
+				return nil, ErrInvalidWAV
+			}
+
+			samples, err := wavSamples(data, bitsPerSample)
+			if err != nil {
+				return nil, err
+			}
+			pcm.Samples = samples
+
+			return pcm, nil
+		}
+
+		// chunks are word aligned
+		if size%2 == 1 && size < len(chunks) {
+			size++
+		}
+		chunks = chunks[size:]
+	}
+
+	return nil, ErrInvalidWAV
+}
+
+// wavSamples converts little endian integer samples to 16 bit samples
+func wavSamples(data []byte, bitsPerSample int) ([]int16, error) {
+	if bitsPerSample%8 != 0 || bitsPerSample < 8 || bitsPerSample > 32 {
+		return nil, ErrInvalidFormat
+	}
+
+	width := bitsPerSample / 8
+	samples := make([]int16, len(data)/width)
+	for i := range samples {
+		s := data[i*width : (i+1)*width]
+		if width == 1 {
+			// 8 bit samples are unsigned
+			samples[i] = int16(int(s[0])-128) << 8
+			continue
+		}
+
+		// the two most significant bytes hold the 16 bit value
+		samples[i] = int16(binary.LittleEndian.Uint16(s[width-2:]))
+	}
+
+	return samples, nil
+}
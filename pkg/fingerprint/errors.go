@@ -2,10 +2,92 @@ package fingerprint
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 )
 
 var (
 	ErrInvalidPath      = errors.New("file does not exists")
 	ErrInvalidFileInput = errors.New("invalid input file")
 	ErrInvalidFormat    = errors.New("invalid file format")
+	ErrEmptyFingerprint = errors.New("empty fingerprint")
+	ErrClipTooLong      = errors.New("clip is longer than the recording")
+	ErrFPcalcNotFound   = errors.New("fpcalc executable not found")
+	ErrFPcalcVersion    = errors.New("unknown fpcalc version")
+
+	// limits on the content of the scanned archives
+	ErrArchiveTooLarge       = errors.New("archive decompressed size exceeds the limit")
+	ErrArchiveTooManyEntries = errors.New("archive entries exceed the limit")
+
+	// causes of an FPcalcError
+	ErrOpenFailed       = errors.New("input file can't be opened")
+	ErrNoAudioStream    = errors.New("no audio stream found")
+	ErrUnsupportedCodec = errors.New("unsupported audio codec")
+	ErrDecodeFailed     = errors.New("audio decoding failed")
+	ErrAudioTooShort    = errors.New("audio too short to be fingerprinted")
+	ErrFPcalcFailed     = errors.New("fpcalc failed")
 )
+
+// fpcalcErrorMessages maps the lowercase fragments of the fpcalc error messages
+// to the FPcalcError causes. They are matched in order
+var fpcalcErrorMessages = []struct {
+	fragment string
+	cause    error
+}{
+	{"codec", ErrUnsupportedCodec},
+	{"audio stream", ErrNoAudioStream},
+	{"stream information", ErrNoAudioStream},
+	{"open the input file", ErrOpenFailed},
+	{"empty fingerprint", ErrAudioTooShort},
+	{"not enough", ErrAudioTooShort},
+	{"decod", ErrDecodeFailed},
+	{"invalid data", ErrDecodeFailed},
+}
+
+// FPcalcError is returned when fpcalc exits with an error. Err is the cause
+// parsed from the fpcalc error output, ErrFPcalcFailed if it isn't known
+type FPcalcError struct {
+	Path    string
+	Err     error
+	Message string
+}
+
+func (e *FPcalcError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s: %s", e.Path, e.Err)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", e.Path, e.Err, e.Message)
+}
+
+func (e *FPcalcError) Unwrap() error {
+	return e.Err
+}
+
+// newFPcalcError parses the stderr output of fpcalc for the file at fPath. fpcalc
+// prefixes its own messages with "ERROR: ", the last one is used. Other lines
+// are usually decoder warnings and are only used when there are no errors
+func newFPcalcError(fPath string, stderr string) *FPcalcError {
+	var message string
+	for _, line := range strings.Split(strings.TrimSpace(stderr), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "ERROR: ") {
+			message = strings.TrimPrefix(line, "ERROR: ")
+		}
+	}
+
+	if message == "" {
+		message = strings.TrimSpace(stderr)
+	}
+
+	cause := ErrFPcalcFailed
+	lower := strings.ToLower(message)
+	for _, m := range fpcalcErrorMessages {
+		if strings.Contains(lower, m.fragment) {
+			cause = m.cause
+			break
+		}
+	}
+
+	return &FPcalcError{Path: fPath, Err: cause, Message: message}
+}
@@ -0,0 +1,66 @@
+package fingerprint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFPcalcError(t *testing.T) {
+	testcases := []struct {
+		name            string
+		stderr          string
+		expectedErr     error
+		expectedMessage string
+	}{
+		{
+			name:            "open failure",
+			stderr:          "ERROR: Could not open the input file (No such file or directory)\n",
+			expectedErr:     ErrOpenFailed,
+			expectedMessage: "Could not open the input file (No such file or directory)",
+		},
+		{
+			name:            "no audio stream",
+			stderr:          "ERROR: Could not find any audio stream in the file\n",
+			expectedErr:     ErrNoAudioStream,
+			expectedMessage: "Could not find any audio stream in the file",
+		},
+		{
+			name:            "unsupported codec",
+			stderr:          "ERROR: Could not open the codec\n",
+			expectedErr:     ErrUnsupportedCodec,
+			expectedMessage: "Could not open the codec",
+		},
+		{
+			name:            "decode failure after warnings",
+			stderr:          "[mp3float @ 0x55d] Header missing\nERROR: Error decoding audio frame (Invalid data found when processing input)\n",
+			expectedErr:     ErrDecodeFailed,
+			expectedMessage: "Error decoding audio frame (Invalid data found when processing input)",
+		},
+		{
+			name:            "audio too short",
+			stderr:          "ERROR: Empty fingerprint\n",
+			expectedErr:     ErrAudioTooShort,
+			expectedMessage: "Empty fingerprint",
+		},
+		{
+			name:            "unknown message",
+			stderr:          "something went wrong\n",
+			expectedErr:     ErrFPcalcFailed,
+			expectedMessage: "something went wrong",
+		},
+		{
+			name:        "no output",
+			expectedErr: ErrFPcalcFailed,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			got := newFPcalcError("/audio.mp3", testcase.stderr)
+			assert.Equal(t, "/audio.mp3", got.Path)
+			assert.Equal(t, testcase.expectedErr, got.Err)
+			assert.Equal(t, testcase.expectedMessage, got.Message)
+		})
+	}
+}
@@ -1,18 +1,92 @@
 package fingerprint
 
-import "os"
+import (
+	"context"
+	"io"
+
+	"github.com/ocramh/fingerprinter/pkg/chromaprint"
+)
 
 // Fingerprinter defines operations for calculating fingerprints from audio files
 type Fingerprinter interface {
 
-	// CalcFingerprint returns a list of fingerprints from an input path
-	CalcFingerprint(fPath string) ([]*Fingerprint, error)
+	// CalcFingerprint returns the fingerprints of the audio files at an input path,
+	// along with the files that couldn't be fingerprinted
+	CalcFingerprint(fPath string) (*BatchResult, error)
+}
+
+// ContextFingerprinter is a Fingerprinter that stops calculating fingerprints
+// when a context is done
+type ContextFingerprinter interface {
+	Fingerprinter
+
+	// CalcFingerprintContext is like CalcFingerprint but returns when ctx is done.
+	// The fingerprints calculated before ctx was done are returned along with
+	// the ctx error
+	CalcFingerprintContext(ctx context.Context, fPath string) (*BatchResult, error)
+}
+
+// ReaderFingerprinter calculates fingerprints from audio streams
+type ReaderFingerprinter interface {
+
+	// CalcFingerprintReader returns the fingerprint of the audio read from r
+	CalcFingerprintReader(ctx context.Context, r io.Reader) (*Fingerprint, error)
 }
 
 // Fingerprint is an audio file fingerprint. The JSON structure allows the struct to
-// parse the chromaprint fpcalc command when executed with the -json flag
+// parse the chromaprint fpcalc command when executed with the -json flag.
+// RelPath is the path of the audio file relative to the scanned directory, or the
+// file name when a single file was fingerprinted. Source identifies the audio
+// file and allows fingerprints to be stored and reloaded. Raw holds the uncompressed
+// sub-fingerprints when they were requested. Files fingerprinted in chunks have
+// a Segment per chunk and no Value
 type Fingerprint struct {
-	Duration  float32     `json:"duration"`
-	Value     string      `json:"fingerprint"`
-	InputFile os.FileInfo `json:"-"`
+	Duration  float32   `json:"duration"`
+	Value     string    `json:"fingerprint"`
+	Raw       []uint32  `json:"raw,omitempty"`
+	Segments  []Segment `json:"segments,omitempty"`
+	Container Container `json:"container,omitempty"`
+	RelPath   string    `json:"path,omitempty"`
+	Source    *Source   `json:"source,omitempty"`
+}
+
+// Segment is the fingerprint of a chunk of an audio file. Timestamp is the time,
+// in seconds, the chunk starts at
+type Segment struct {
+	Timestamp float32  `json:"timestamp"`
+	Duration  float32  `json:"duration"`
+	Value     string   `json:"fingerprint"`
+	Raw       []uint32 `json:"raw,omitempty"`
+}
+
+// Path returns the path of the audio file the Fingerprint was calculated from.
+// Files stored in an archive are identified by the archive path and the entry
+// name, as in archive.zip!/dir/track.mp3. It falls back to RelPath for the
+// fingerprints without a Source, which Fingerprinter implementations aren't
+// required to set
+func (f *Fingerprint) Path() string {
+	if f.Source == nil || f.Source.Path == "" {
+		return f.RelPath
+	}
+
+	if f.Source.Entry != "" {
+		return f.Source.Path + "!/" + f.Source.Entry
+	}
+
+	return f.Source.Path
+}
+
+// RawValues returns the raw sub-fingerprints, decoding the compressed Value when
+// Raw is not set
+func (f *Fingerprint) RawValues() ([]uint32, error) {
+	if f.Raw != nil {
+		return f.Raw, nil
+	}
+
+	raw, _, err := chromaprint.DecodeFingerprint(f.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return raw, nil
 }
@@ -0,0 +1,329 @@
+// Package fingerprinttest provides a fake fpcalc executable to test the code
+// built on fingerprint.ChromaPrint without installing Chromaprint.
+//
+// The fake runs in the test binary itself, which must call Main from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		fingerprinttest.Main()
+//		os.Exit(m.Run())
+//	}
+//
+// ChromaPrint then runs the fake through FPcalc.ExecCmd:
+//
+//	fpcalc := fingerprinttest.NewFPcalc(t)
+//	fpcalc.OnFile("/audio/track.mp3", fingerprinttest.Response{ExitCode: 2})
+//	chroma, err := fingerprint.NewChromaPrint(fpcalc.ExecCmd, fs, fingerprint.WithFPcalcPath("fpcalc"))
+package fingerprinttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	// DefaultVersion is the fpcalc version reported by the fake
+	DefaultVersion = "1.5.1"
+	// DefaultDuration and DefaultFingerprint are the fake output for the files
+	// without a Response
+	DefaultDuration    = 10.5
+	DefaultFingerprint = "the-fingerprint"
+
+	// configEnv passes the behaviour of the fake to the test binary
+	configEnv = "FINGERPRINTTEST_FPCALC"
+	stdinPath = "-"
+)
+
+// DefaultRaw is the fake output for the files without a Response when fpcalc
+// runs with -raw
+var DefaultRaw = []uint32{1, 3}
+
+// Response is the behaviour of the fake fpcalc for an input file. The output is
+// the fpcalc JSON output of Duration and Fingerprint, unless Stdout is set. It
+// is only written when ExitCode is 0. Like fpcalc, the output follows the
+// command line flags: Raw replaces Fingerprint with -raw, Duration is capped by
+// -length and -chunk prints a JSON object per chunk, all with the same
+// fingerprint. Chunks never overlap, -overlap is ignored
+type Response struct {
+	Duration    float64       `json:"duration"`
+	Fingerprint string        `json:"fingerprint"`
+	Raw         []uint32      `json:"raw"`
+	Stdout      string        `json:"stdout"`
+	Stderr      string        `json:"stderr"`
+	ExitCode    int           `json:"exit_code"`
+	Delay       time.Duration `json:"delay"`
+	// StdinLimit is the number of bytes read from stdin before responding, like
+	// fpcalc stops reading after the analysed length. 0 reads all of stdin
+	StdinLimit int64 `json:"stdin_limit"`
+}
+
+// config is the behaviour of a single fake fpcalc process
+type config struct {
+	Version   string   `json:"version"`
+	Response  Response `json:"response"`
+	StdinFile string   `json:"stdin_file"`
+}
+
+// Call is an invocation of the fake fpcalc
+type Call struct {
+	Name string
+	Args []string
+
+	stdinFile string
+}
+
+// Path returns the input file of the call, "-" when the audio is read from
+// stdin and "" for version checks
+func (c Call) Path() string {
+	if c.IsVersionCheck() || len(c.Args) == 0 {
+		return ""
+	}
+
+	return c.Args[len(c.Args)-1]
+}
+
+// IsVersionCheck reports whether the call checked the fpcalc version
+func (c Call) IsVersionCheck() bool {
+	return len(c.Args) == 1 && c.Args[0] == "-version"
+}
+
+// Stdin returns the data read from stdin by the fake, once it has exited
+func (c Call) Stdin() []byte {
+	if c.stdinFile == "" {
+		return nil
+	}
+
+	b, _ := ioutil.ReadFile(c.stdinFile)
+	return b
+}
+
+// FPcalc is a fake fpcalc executable. Files are fingerprinted according to the
+// Response set for their path, or Default. FPcalc is safe for concurrent use
+type FPcalc struct {
+	// Version is the fpcalc version reported by the fake
+	Version string
+	// Default is the Response for the files without one
+	Default Response
+
+	dir   string
+	mu    sync.Mutex
+	files map[string]Response
+	calls []Call
+}
+
+// NewFPcalc returns a FPcalc reporting DefaultVersion and fingerprinting every
+// file as DefaultFingerprint, or DefaultRaw with -raw
+func NewFPcalc(t testing.TB) *FPcalc {
+	return &FPcalc{
+		Version: DefaultVersion,
+		Default: Response{
+			Duration:    DefaultDuration,
+			Fingerprint: DefaultFingerprint,
+			Raw:         append([]uint32(nil), DefaultRaw...),
+		},
+		dir:   t.TempDir(),
+		files: make(map[string]Response),
+	}
+}
+
+// OnFile sets the Response for the input file at path, as passed to fpcalc. Use
+// "-" for the audio read from stdin
+func (f *FPcalc) OnFile(path string, r Response) *FPcalc {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.files[path] = r
+	return f
+}
+
+// Calls returns the invocations of the fake, version checks included, in the
+// order they were made
+func (f *FPcalc) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]Call(nil), f.calls...)
+}
+
+// Paths returns the input files fingerprinted by the fake, in the order they
+// were fingerprinted
+func (f *FPcalc) Paths() []string {
+	var paths []string
+	for _, c := range f.Calls() {
+		if !c.IsVersionCheck() {
+			paths = append(paths, c.Path())
+		}
+	}
+
+	return paths
+}
+
+// ExecCmd implements fingerprint.ExecCmd, returning a command that runs the
+// test binary as the fake fpcalc
+func (f *FPcalc) ExecCmd(name string, args ...string) *exec.Cmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	call := Call{Name: name, Args: args}
+	cfg := config{Version: f.Version, Response: f.Default}
+	if r, ok := f.files[call.Path()]; ok {
+		cfg.Response = r
+	}
+
+	if call.Path() == stdinPath {
+		call.stdinFile = filepath.Join(f.dir, fmt.Sprintf("stdin-%d", len(f.calls)))
+		cfg.StdinFile = call.stdinFile
+	}
+	f.calls = append(f.calls, call)
+
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Args[0] = name
+	cmd.Env = append(os.Environ(), configEnv+"="+string(b))
+
+	return cmd
+}
+
+// Main runs the fake fpcalc and exits when the test binary was started by
+// FPcalc.ExecCmd, and returns immediately otherwise. It must be called at the
+// start of TestMain
+func Main() {
+	env, ok := os.LookupEnv(configEnv)
+	if !ok {
+		return
+	}
+
+	var cfg config
+	if err := json.Unmarshal([]byte(env), &cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid fake fpcalc configuration: %s\n", err)
+		os.Exit(1)
+	}
+
+	os.Exit(run(cfg, os.Args[1:]))
+}
+
+func run(cfg config, args []string) int {
+	if len(args) == 1 && args[0] == "-version" {
+		fmt.Fprintf(os.Stdout, "fpcalc version %s\n", cfg.Version)
+		return 0
+	}
+
+	r := cfg.Response
+	if cfg.StdinFile != "" {
+		var stdin io.Reader = os.Stdin
+		if r.StdinLimit > 0 {
+			stdin = io.LimitReader(os.Stdin, r.StdinLimit)
+		}
+
+		input, err := ioutil.ReadAll(stdin)
+		if err == nil {
+			err = ioutil.WriteFile(cfg.StdinFile, input, 0600)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+			return 1
+		}
+	}
+
+	time.Sleep(r.Delay)
+
+	fmt.Fprint(os.Stderr, r.Stderr)
+	switch {
+	case r.ExitCode != 0:
+	case r.Stdout != "":
+		fmt.Fprint(os.Stdout, r.Stdout)
+	default:
+		if err := writeOutput(os.Stdout, r, parseFlags(args)); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+			return 1
+		}
+	}
+
+	return r.ExitCode
+}
+
+// flags are the fpcalc command line flags shaping the output
+type flags struct {
+	raw    bool
+	length float64
+	chunk  float64
+}
+
+func parseFlags(args []string) flags {
+	var f flags
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-raw":
+			f.raw = true
+		case "-length":
+			if i+1 < len(args) {
+				i++
+				f.length, _ = strconv.ParseFloat(args[i], 64)
+			}
+		case "-chunk":
+			if i+1 < len(args) {
+				i++
+				f.chunk, _ = strconv.ParseFloat(args[i], 64)
+			}
+		}
+	}
+
+	return f
+}
+
+// output is a JSON object printed by fpcalc. Timestamp is only printed in chunk
+// mode
+type output struct {
+	Timestamp   *float64    `json:"timestamp,omitempty"`
+	Duration    float64     `json:"duration"`
+	Fingerprint interface{} `json:"fingerprint"`
+}
+
+// writeOutput writes the fpcalc JSON output of r to w
+func writeOutput(w io.Writer, r Response, f flags) error {
+	duration := r.Duration
+	if f.length > 0 && f.length < duration {
+		duration = f.length
+	}
+
+	var fingerprint interface{} = r.Fingerprint
+	if f.raw {
+		raw := r.Raw
+		if raw == nil {
+			raw = []uint32{}
+		}
+		fingerprint = raw
+	}
+
+	enc := json.NewEncoder(w)
+	if f.chunk <= 0 {
+		return enc.Encode(output{Duration: duration, Fingerprint: fingerprint})
+	}
+
+	for start := 0.0; start < duration; start += f.chunk {
+		timestamp := start
+		err := enc.Encode(output{
+			Timestamp:   &timestamp,
+			Duration:    math.Min(f.chunk, duration-start),
+			Fingerprint: fingerprint,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package fingerprinttest
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	Main()
+	os.Exit(m.Run())
+}
+
+func runFake(cmd *exec.Cmd) (string, string, error) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+
+	return stdout.String(), stderr.String(), err
+}
+
+func TestFPcalcVersion(t *testing.T) {
+	fpcalc := NewFPcalc(t)
+	fpcalc.Version = "1.4.3"
+
+	stdout, _, err := runFake(fpcalc.ExecCmd("fpcalc", "-version"))
+	assert.NoError(t, err)
+	assert.Equal(t, "fpcalc version 1.4.3\n", stdout)
+	assert.True(t, fpcalc.Calls()[0].IsVersionCheck())
+	assert.Empty(t, fpcalc.Paths())
+}
+
+func TestFPcalcResponses(t *testing.T) {
+	fpcalc := NewFPcalc(t).
+		OnFile("/audio/b.mp3", Response{Duration: 3, Fingerprint: "AQAB"}).
+		OnFile("/audio/c.mp3", Response{Stderr: "ERROR: Error decoding audio frame\n", ExitCode: 2})
+
+	stdout, _, err := runFake(fpcalc.ExecCmd("fpcalc", "-json", "/audio/a.mp3"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"duration": 10.5, "fingerprint": "the-fingerprint"}`, stdout)
+
+	stdout, _, err = runFake(fpcalc.ExecCmd("fpcalc", "-json", "/audio/b.mp3"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"duration": 3, "fingerprint": "AQAB"}`, stdout)
+
+	stdout, stderr, err := runFake(fpcalc.ExecCmd("fpcalc", "-json", "/audio/c.mp3"))
+	var exitErr *exec.ExitError
+	assert.True(t, errors.As(err, &exitErr))
+	assert.Equal(t, 2, exitErr.ExitCode())
+	assert.Empty(t, stdout)
+	assert.Equal(t, "ERROR: Error decoding audio frame\n", stderr)
+
+	assert.Equal(t, []string{"/audio/a.mp3", "/audio/b.mp3", "/audio/c.mp3"}, fpcalc.Paths())
+	assert.Equal(t, "fpcalc", fpcalc.Calls()[0].Name)
+	assert.Equal(t, []string{"-json", "/audio/a.mp3"}, fpcalc.Calls()[0].Args)
+}
+
+func TestFPcalcStdin(t *testing.T) {
+	fpcalc := NewFPcalc(t)
+
+	cmd := fpcalc.ExecCmd("fpcalc", "-json", "-")
+	cmd.Stdin = strings.NewReader("audio content")
+	_, _, err := runFake(cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("audio content"), fpcalc.Calls()[0].Stdin())
+
+	fpcalc.OnFile("-", Response{StdinLimit: 5})
+	cmd = fpcalc.ExecCmd("fpcalc", "-json", "-")
+	cmd.Stdin = strings.NewReader("audio content")
+	_, _, err = runFake(cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("audio"), fpcalc.Calls()[1].Stdin())
+}
+
+func TestFPcalcDelay(t *testing.T) {
+	fpcalc := NewFPcalc(t)
+	fpcalc.Default.Delay = 200 * time.Millisecond
+
+	start := time.Now()
+	_, _, err := runFake(fpcalc.ExecCmd("fpcalc", "-json", "/audio/a.mp3"))
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= fpcalc.Default.Delay)
+}
+
+func TestFPcalcOutputFlags(t *testing.T) {
+	fpcalc := NewFPcalc(t)
+
+	stdout, _, err := runFake(fpcalc.ExecCmd("fpcalc", "-json", "-raw", "/audio/a.mp3"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"duration": 10.5, "fingerprint": [1, 3]}`, stdout)
+
+	stdout, _, err = runFake(fpcalc.ExecCmd("fpcalc", "-json", "-length", "5", "/audio/a.mp3"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"duration": 5, "fingerprint": "the-fingerprint"}`, stdout)
+
+	// a JSON object per chunk
+	stdout, _, err = runFake(fpcalc.ExecCmd("fpcalc", "-json", "-raw", "-chunk", "4", "-overlap", "/audio/a.mp3"))
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	assert.Len(t, lines, 3)
+	assert.JSONEq(t, `{"timestamp": 0, "duration": 4, "fingerprint": [1, 3]}`, lines[0])
+	assert.JSONEq(t, `{"timestamp": 4, "duration": 4, "fingerprint": [1, 3]}`, lines[1])
+	assert.JSONEq(t, `{"timestamp": 8, "duration": 2.5, "fingerprint": [1, 3]}`, lines[2])
+}
@@ -0,0 +1,233 @@
+package fingerprint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/ocramh/fingerprinter/pkg/chromaprint"
+)
+
+// MinFPcalcVersion is the oldest supported fpcalc version, the first one
+// printing JSON output
+var MinFPcalcVersion = FPcalcVersion{Major: 1, Minor: 4, Patch: 0}
+
+var fpcalcVersionRe = regexp.MustCompile(`version (\d+)\.(\d+)(?:\.(\d+))?`)
+
+// FPcalcVersion is the version of the fpcalc executable
+type FPcalcVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+func (v FPcalcVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+func (v FPcalcVersion) less(o FPcalcVersion) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+
+	return v.Patch < o.Patch
+}
+
+// UnsupportedVersionError is returned when the fpcalc executable is older than
+// the minimum supported version
+type UnsupportedVersionError struct {
+	Version FPcalcVersion
+	Min     FPcalcVersion
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported fpcalc version %s, version %s or later is required", e.Version, e.Min)
+}
+
+// parseFPcalcVersion parses the output of fpcalc -version, e.g.
+// "fpcalc version 1.5.1 (FFmpeg Lavc58.134.100 Lavf58.76.100 SwR3.9.100)"
+func parseFPcalcVersion(output string) (FPcalcVersion, error) {
+	m := fpcalcVersionRe.FindStringSubmatch(output)
+	if m == nil {
+		return FPcalcVersion{}, fmt.Errorf("%w: %q", ErrFPcalcVersion, output)
+	}
+
+	var v FPcalcVersion
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.Patch, _ = strconv.Atoi(m[3])
+	}
+
+	return v, nil
+}
+
+// fpcalcOptions holds the fpcalc command line settings. Zero values leave the
+// fpcalc defaults in place
+type fpcalcOptions struct {
+	raw       bool
+	length    *time.Duration
+	algorithm int
+	rate      int
+	channels  int
+	chunk     time.Duration
+	overlap   bool
+}
+
+// WithRawFingerprint makes ChromaPrint run fpcalc with the -raw flag and set the
+// Fingerprint Raw values. The compressed Value is still set
+func WithRawFingerprint() ChromaPrintOption {
+	return func(c *ChromaPrint) {
+		c.fpcalc.raw = true
+	}
+}
+
+// WithLength sets the duration of audio fpcalc analyses from the beginning of
+// each file, rounded down to the second. fpcalc analyses the first 120 seconds
+// by default, a length of 0 fingerprints whole files
+func WithLength(d time.Duration) ChromaPrintOption {
+	return func(c *ChromaPrint) {
+		c.fpcalc.length = &d
+	}
+}
+
+// WithAlgorithm sets the fpcalc fingerprinting algorithm. Algorithms are
+// numbered from 1 as in fpcalc, which uses algorithm 2 by default
+func WithAlgorithm(algorithm int) ChromaPrintOption {
+	return func(c *ChromaPrint) {
+		c.fpcalc.algorithm = algorithm
+	}
+}
+
+// WithInputFormat sets the sample rate and number of channels of the input
+// audio, which fpcalc can't detect for raw PCM files. A zero value is ignored
+func WithInputFormat(sampleRate int, channels int) ChromaPrintOption {
+	return func(c *ChromaPrint) {
+		c.fpcalc.rate = sampleRate
+		c.fpcalc.channels = channels
+	}
+}
+
+// WithChunks makes fpcalc split files into chunks of the given duration, rounded
+// down to the second, and fingerprint each of them. The resulting Fingerprints
+// hold a Segment per chunk instead of a Value. When overlap is true the chunks
+// overlap slightly so the audio at their edges is fingerprinted too.
+// Use WithLength(0) to split whole files
+func WithChunks(chunk time.Duration, overlap bool) ChromaPrintOption {
+	return func(c *ChromaPrint) {
+		c.fpcalc.chunk = chunk
+		c.fpcalc.overlap = overlap
+	}
+}
+
+// args returns the fpcalc command line arguments for the file at fPath
+func (o fpcalcOptions) args(fPath string) []string {
+	return append(o.flags(), fPath)
+}
+
+// flags returns the fpcalc command line flags
+func (o fpcalcOptions) flags() []string {
+	args := []string{"-json"}
+	if o.raw {
+		args = append(args, "-raw")
+	}
+	if o.length != nil {
+		args = append(args, "-length", strconv.Itoa(int(o.length.Seconds())))
+	}
+	if o.algorithm > 0 {
+		args = append(args, "-algorithm", strconv.Itoa(o.algorithm))
+	}
+	if o.rate > 0 {
+		args = append(args, "-rate", strconv.Itoa(o.rate))
+	}
+	if o.channels > 0 {
+		args = append(args, "-channels", strconv.Itoa(o.channels))
+	}
+	if o.chunk > 0 {
+		args = append(args, "-chunk", strconv.Itoa(int(o.chunk.Seconds())))
+	}
+	if o.overlap {
+		args = append(args, "-overlap")
+	}
+
+	return args
+}
+
+// fpcalcOutput is a JSON object printed by fpcalc. Fingerprint is a string, or
+// an array of sub-fingerprints when fpcalc runs with -raw. The timestamp is only
+// printed in chunk mode
+type fpcalcOutput struct {
+	Timestamp   float32         `json:"timestamp"`
+	Duration    float32         `json:"duration"`
+	Fingerprint json.RawMessage `json:"fingerprint"`
+}
+
+// parseOutput parses the JSON printed by fpcalc. In chunk mode fpcalc prints an
+// object per chunk, which are returned as the Fingerprint Segments
+func (o fpcalcOptions) parseOutput(r io.Reader) (*Fingerprint, error) {
+	var segments []Segment
+
+	dec := json.NewDecoder(r)
+	for {
+		var out fpcalcOutput
+		err := dec.Decode(&out)
+		if err == io.EOF && len(segments) > 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		seg := Segment{Timestamp: out.Timestamp, Duration: out.Duration}
+		if err := o.decodeValue(out.Fingerprint, &seg); err != nil {
+			return nil, err
+		}
+		segments = append(segments, seg)
+
+		if o.chunk <= 0 {
+			break
+		}
+	}
+
+	if o.chunk <= 0 {
+		return &Fingerprint{
+			Duration: segments[0].Duration,
+			Value:    segments[0].Value,
+			Raw:      segments[0].Raw,
+		}, nil
+	}
+
+	last := segments[len(segments)-1]
+
+	return &Fingerprint{
+		Duration: last.Timestamp + last.Duration,
+		Segments: segments,
+	}, nil
+}
+
+// decodeValue sets the seg Value and, in raw mode, its Raw values from the
+// fingerprint printed by fpcalc
+func (o fpcalcOptions) decodeValue(fingerprint json.RawMessage, seg *Segment) error {
+	if !o.raw {
+		return json.Unmarshal(fingerprint, &seg.Value)
+	}
+
+	if err := json.Unmarshal(fingerprint, &seg.Raw); err != nil {
+		return err
+	}
+
+	// fpcalc numbers algorithms from 1, the compressed header from 0
+	algorithm := chromaprint.AlgorithmTest2
+	if o.algorithm > 0 {
+		algorithm = o.algorithm - 1
+	}
+	seg.Value = chromaprint.EncodeFingerprint(seg.Raw, algorithm)
+
+	return nil
+}
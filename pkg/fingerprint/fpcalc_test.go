@@ -0,0 +1,156 @@
+package fingerprint
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ocramh/fingerprinter/pkg/fingerprint/fingerprinttest"
+)
+
+func TestFPcalcArgs(t *testing.T) {
+	testcases := []struct {
+		name     string
+		opts     []ChromaPrintOption
+		expected []string
+	}{
+		{
+			name:     "defaults",
+			expected: []string{"-json", "/audio.mp3"},
+		},
+		{
+			name:     "raw",
+			opts:     []ChromaPrintOption{WithRawFingerprint()},
+			expected: []string{"-json", "-raw", "/audio.mp3"},
+		},
+		{
+			name:     "whole file",
+			opts:     []ChromaPrintOption{WithLength(0)},
+			expected: []string{"-json", "-length", "0", "/audio.mp3"},
+		},
+		{
+			name: "all options",
+			opts: []ChromaPrintOption{
+				WithLength(300 * time.Second),
+				WithAlgorithm(4),
+				WithInputFormat(44100, 2),
+				WithChunks(10*time.Second, true),
+			},
+			expected: []string{
+				"-json", "-length", "300", "-algorithm", "4", "-rate", "44100", "-channels", "2",
+				"-chunk", "10", "-overlap", "/audio.mp3",
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			chromap := mustNewChromaPrint(mockExec(t), mustSetupFS(), testcase.opts...)
+			assert.Equal(t, testcase.expected, chromap.fpcalc.args("/audio.mp3"))
+		})
+	}
+}
+
+func TestFPcalcParseOutput(t *testing.T) {
+	testcases := []struct {
+		name     string
+		opts     fpcalcOptions
+		output   string
+		expected *Fingerprint
+	}{
+		{
+			name:     "compressed",
+			output:   `{"duration": 10.5, "fingerprint": "AQAAAQE"}`,
+			expected: &Fingerprint{Duration: 10.5, Value: "AQAAAQE"},
+		},
+		{
+			name:     "raw",
+			opts:     fpcalcOptions{raw: true},
+			output:   `{"duration": 10.5, "fingerprint": [1]}`,
+			expected: &Fingerprint{Duration: 10.5, Value: "AQAAAQE", Raw: []uint32{1}},
+		},
+		{
+			name:     "raw with algorithm",
+			opts:     fpcalcOptions{raw: true, algorithm: 3},
+			output:   `{"duration": 10.5, "fingerprint": [1]}`,
+			expected: &Fingerprint{Duration: 10.5, Value: "AgAAAQE", Raw: []uint32{1}},
+		},
+		{
+			name: "chunks",
+			opts: fpcalcOptions{chunk: 10 * time.Second},
+			output: `{"timestamp": 0.00, "duration": 10.00, "fingerprint": "AQAAAQE"}
+{"timestamp": 10.00, "duration": 4.50, "fingerprint": "AQAAAQI"}
+`,
+			expected: &Fingerprint{
+				Duration: 14.5,
+				Segments: []Segment{
+					{Timestamp: 0, Duration: 10, Value: "AQAAAQE"},
+					{Timestamp: 10, Duration: 4.5, Value: "AQAAAQI"},
+				},
+			},
+		},
+		{
+			name:   "raw chunks",
+			opts:   fpcalcOptions{raw: true, chunk: 10 * time.Second},
+			output: `{"timestamp": 0.00, "duration": 10.00, "fingerprint": [1]}`,
+			expected: &Fingerprint{
+				Duration: 10,
+				Segments: []Segment{
+					{Timestamp: 0, Duration: 10, Value: "AQAAAQE", Raw: []uint32{1}},
+				},
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			got, err := testcase.opts.parseOutput(strings.NewReader(testcase.output))
+			assert.NoError(t, err)
+			assert.Equal(t, testcase.expected, got)
+		})
+	}
+}
+
+func TestFPcalcParseInvalidOutput(t *testing.T) {
+	for _, output := range []string{"", "not json", `{"duration": 10.5, "fingerprint": [1]}`} {
+		_, err := fpcalcOptions{}.parseOutput(strings.NewReader(output))
+		assert.Error(t, err, output)
+	}
+}
+
+func TestParseFPcalcVersion(t *testing.T) {
+	testcases := []struct {
+		name     string
+		output   string
+		expected FPcalcVersion
+	}{
+		{name: "version only", output: "fpcalc version 1.4.3\n", expected: FPcalcVersion{1, 4, 3}},
+		{name: "with ffmpeg", output: "fpcalc version 1.5.1 (FFmpeg Lavc58.134.100 Lavf58.76.100 SwR3.9.100)\n", expected: FPcalcVersion{1, 5, 1}},
+		{name: "no patch", output: "fpcalc version 1.5", expected: FPcalcVersion{1, 5, 0}},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			got, err := parseFPcalcVersion(testcase.output)
+			assert.NoError(t, err)
+			assert.Equal(t, testcase.expected, got)
+		})
+	}
+
+	_, err := parseFPcalcVersion("usage: fpcalc [OPTIONS] FILE")
+	assert.True(t, errors.Is(err, ErrFPcalcVersion))
+}
+
+func TestUnsupportedFPcalcVersion(t *testing.T) {
+	fpcalc := fingerprinttest.NewFPcalc(t)
+	fpcalc.Version = "1.3.2"
+
+	_, err := NewChromaPrint(fpcalc.ExecCmd, mustSetupFS(), WithFPcalcPath("fpcalc"))
+	var versionErr *UnsupportedVersionError
+	assert.True(t, errors.As(err, &versionErr))
+	assert.Equal(t, FPcalcVersion{1, 3, 2}, versionErr.Version)
+	assert.Equal(t, MinFPcalcVersion, versionErr.Min)
+}
@@ -0,0 +1,182 @@
+package fingerprint
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/ocramh/fingerprinter/pkg/chromaprint"
+)
+
+const (
+	// DefaultMaxDuration is the length of audio analysed when calculating a
+	// fingerprint. It matches the fpcalc default
+	DefaultMaxDuration = 120 * time.Second
+)
+
+// GoChromaPrint is a Fingerprinter implementation that calculates Chromaprint
+// fingerprints in process, without depending on the fpcalc executable.
+// Audio files are decoded to PCM by the Decoder registered for their extension
+type GoChromaPrint struct {
+	os          afero.Fs
+	decoders    map[string]Decoder
+	maxDuration time.Duration
+}
+
+// NewGoChromaPrint returns a GoChromaPrint able to decode WAV files. Decoders for
+// other formats can be added with RegisterDecoder
+func NewGoChromaPrint(os afero.Fs) *GoChromaPrint {
+	return &GoChromaPrint{
+		os: os,
+		decoders: map[string]Decoder{
+			".wav": WAVDecoder{},
+		},
+		maxDuration: DefaultMaxDuration,
+	}
+}
+
+// RegisterDecoder sets the Decoder used for files with the ext extension
+func (g *GoChromaPrint) RegisterDecoder(ext string, d Decoder) {
+	g.decoders[strings.ToLower(ext)] = d
+}
+
+// CalcFingerprint returns the audio Fingerprint of the file at fPath.
+// fPath can be a path to a directory or to a single file
+func (g *GoChromaPrint) CalcFingerprint(fPath string) (*BatchResult, error) {
+	return g.CalcFingerprintContext(context.Background(), fPath)
+}
+
+// CalcFingerprintContext is like CalcFingerprint but stops fingerprinting new
+// files when ctx is done
+func (g *GoChromaPrint) CalcFingerprintContext(ctx context.Context, fPath string) (*BatchResult, error) {
+	fInfo, err := fileinfoFromPath(g.os, fPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &scanner{
+		fs:          g.os,
+		concurrency: runtime.NumCPU(),
+		detect:      g.detectAudio,
+		calc:        g.fingerprintFile,
+	}
+
+	if fInfo.IsDir() {
+		return s.scanDir(ctx, fPath)
+	}
+
+	return s.scanFile(ctx, fInfo, fPath)
+}
+
+func (g *GoChromaPrint) hasDecoder(ext string) bool {
+	_, ok := g.decoders[strings.ToLower(ext)]
+	return ok
+}
+
+// detectAudio accepts the files a decoder is registered for. Decoders are selected
+// by file extension, so the container is left for them to validate
+func (g *GoChromaPrint) detectAudio(fInfo os.FileInfo, fPath string) (Container, error) {
+	if !g.hasDecoder(filepath.Ext(fInfo.Name())) {
+		return "", ErrInvalidFormat
+	}
+
+	return "", nil
+}
+
+func (g *GoChromaPrint) fingerprintFile(ctx context.Context, f audioFile) (*Fingerprint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	file, err := g.os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	pcm, err := g.decoders[strings.ToLower(filepath.Ext(f.path))].Decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	fp, err := g.fingerprintPCM(pcm)
+	if err != nil {
+		return nil, err
+	}
+
+	return fp, nil
+}
+
+// CalcFingerprintReader returns the Fingerprint of the audio read from r. The
+// decoder is selected from the sniffed container of the stream. r is read until
+// EOF to calculate the Fingerprint Source, which has no Path
+func (g *GoChromaPrint) CalcFingerprintReader(ctx context.Context, r io.Reader) (*Fingerprint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	src := newSourceReader(r)
+	br := bufio.NewReader(src)
+	container, err := sniffReader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoder Decoder
+	for _, ext := range containerExtensions[container] {
+		if d, ok := g.decoders[ext]; ok {
+			decoder = d
+			break
+		}
+	}
+	if decoder == nil {
+		return nil, ErrInvalidFormat
+	}
+
+	pcm, err := decoder.Decode(br)
+	if err != nil {
+		return nil, err
+	}
+
+	fp, err := g.fingerprintPCM(pcm)
+	if err != nil {
+		return nil, err
+	}
+
+	fp.Container = container
+	fp.Source, err = src.source()
+	if err != nil {
+		return nil, err
+	}
+
+	return fp, nil
+}
+
+func (g *GoChromaPrint) fingerprintPCM(pcm *PCM) (*Fingerprint, error) {
+	if pcm.Channels <= 0 || pcm.SampleRate <= 0 {
+		return nil, ErrInvalidFileInput
+	}
+
+	samples := pcm.Samples
+	maxSamples := int(g.maxDuration.Seconds() * float64(pcm.SampleRate) * float64(pcm.Channels))
+	if len(samples) > maxSamples {
+		samples = samples[:maxSamples]
+	}
+
+	raw, err := chromaprint.Fingerprint(samples, pcm.SampleRate, pcm.Channels)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Fingerprint{
+		Duration: float32(len(pcm.Samples)/pcm.Channels) / float32(pcm.SampleRate),
+		Value:    chromaprint.EncodeFingerprint(raw, chromaprint.AlgorithmTest2),
+	}, nil
+}
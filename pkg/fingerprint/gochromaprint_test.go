@@ -0,0 +1,237 @@
+package fingerprint
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	// audioTestDataDir contains the audio files used to compare GoChromaPrint
+	// with fpcalc, 4 seconds of chords recorded at 11025, 44100 and 48000 Hz so
+	// that resampling is covered. The output of `fpcalc -json <file>` is recorded
+	// next to each file in <file>.fpcalc.json, see recordFPcalc
+	audioTestDataDir  = "../../test/data/audio"
+	fpcalcOutputExt   = ".fpcalc.json"
+	testWAVFile       = "tone.wav"
+	testWAVSampleRate = 11025
+)
+
+// wavBytes returns a 16 bit PCM WAV file containing a sequence of tones
+func wavBytes(seconds int, sampleRate int, channels int) []byte {
+	freqs := []float64{440, 660, 880}
+
+	data := new(bytes.Buffer)
+	for i := 0; i < seconds*sampleRate; i++ {
+		f := freqs[(i/sampleRate)%len(freqs)]
+		v := int16(8000 * math.Sin(2*math.Pi*f*float64(i)/float64(sampleRate)))
+		for ch := 0; ch < channels; ch++ {
+			binary.Write(data, binary.LittleEndian, v)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("RIFF")
+	binary.Write(buf, binary.LittleEndian, uint32(36+data.Len()))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(buf, binary.LittleEndian, uint32(16))
+	binary.Write(buf, binary.LittleEndian, uint16(wavFormatPCM))
+	binary.Write(buf, binary.LittleEndian, uint16(channels))
+	binary.Write(buf, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(buf, binary.LittleEndian, uint32(sampleRate*channels*2))
+	binary.Write(buf, binary.LittleEndian, uint16(channels*2))
+	binary.Write(buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	binary.Write(buf, binary.LittleEndian, uint32(data.Len()))
+	buf.Write(data.Bytes())
+
+	return buf.Bytes()
+}
+
+func TestGoChromaPrintFromFile(t *testing.T) {
+	mockFS := mustSetupFS()
+	inputFile := path.Join(testDataDir, testWAVFile)
+	err := afero.WriteFile(mockFS, inputFile, wavBytes(10, testWAVSampleRate, 2), 0644)
+	assert.NoError(t, err)
+
+	chromap := NewGoChromaPrint(mockFS)
+	got, err := chromap.CalcFingerprint(inputFile)
+	assert.NoError(t, err)
+	assert.Len(t, got.Fingerprints, 1)
+	assert.Equal(t, float32(10), got.Fingerprints[0].Duration)
+	assert.Equal(t, inputFile, got.Fingerprints[0].Source.Path)
+
+	// the compressed fingerprint header contains the algorithm and the number of
+	// sub-fingerprints
+	compressed, err := base64.RawURLEncoding.DecodeString(got.Fingerprints[0].Value)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 0, 0, 58}, compressed[:4])
+}
+
+func TestGoChromaPrintFromDir(t *testing.T) {
+	mockFS := mustSetupFS()
+	err := afero.WriteFile(mockFS, path.Join(testDataDir, testWAVFile), wavBytes(10, testWAVSampleRate, 1), 0644)
+	assert.NoError(t, err)
+
+	chromap := NewGoChromaPrint(mockFS)
+	got, err := chromap.CalcFingerprint(testDataDir)
+	assert.NoError(t, err)
+	assert.Len(t, got.Fingerprints, 1)
+	assert.Equal(t, testWAVFile, got.Fingerprints[0].RelPath)
+	assert.Equal(t, path.Join(testDataDir, testWAVFile), got.Fingerprints[0].Source.Path)
+}
+
+func TestGoChromaPrintFromReader(t *testing.T) {
+	mockFS := mustSetupFS()
+	inputFile := path.Join(testDataDir, testWAVFile)
+	content := wavBytes(10, testWAVSampleRate, 1)
+	assert.NoError(t, afero.WriteFile(mockFS, inputFile, content, 0644))
+
+	chromap := NewGoChromaPrint(mockFS)
+	fromFile, err := chromap.CalcFingerprint(inputFile)
+	assert.NoError(t, err)
+
+	got, err := chromap.CalcFingerprintReader(context.Background(), bytes.NewReader(content))
+	assert.NoError(t, err)
+	assert.Equal(t, fromFile.Fingerprints[0].Value, got.Value)
+	assert.Equal(t, ContainerWAV, got.Container)
+	assert.Equal(t, fromFile.Fingerprints[0].Source.Hash, got.Source.Hash)
+
+	_, err = chromap.CalcFingerprintReader(context.Background(), bytes.NewReader(mp3Header))
+	assert.Equal(t, ErrInvalidFormat, err)
+}
+
+func TestGoChromaPrintInputErrors(t *testing.T) {
+	mockFS := mustSetupFS()
+	chromap := NewGoChromaPrint(mockFS)
+
+	_, err := chromap.CalcFingerprint(path.Join(testDataDir, testFile3))
+	assert.Equal(t, ErrInvalidFormat, err)
+
+	chromap.RegisterDecoder(".txt", WAVDecoder{})
+	_, err = chromap.CalcFingerprint(path.Join(testDataDir, testFile3))
+	assert.True(t, errors.Is(err, ErrInvalidWAV))
+}
+
+// wavWithFormat returns a WAV file of 32 bit samples with the given format code.
+// subFormat is the format code of the WAVE_FORMAT_EXTENSIBLE extension
+func wavWithFormat(format uint16, subFormat uint16) []byte {
+	fmtChunk := new(bytes.Buffer)
+	binary.Write(fmtChunk, binary.LittleEndian, format)
+	binary.Write(fmtChunk, binary.LittleEndian, uint16(1))
+	binary.Write(fmtChunk, binary.LittleEndian, uint32(testWAVSampleRate))
+	binary.Write(fmtChunk, binary.LittleEndian, uint32(testWAVSampleRate*4))
+	binary.Write(fmtChunk, binary.LittleEndian, uint16(4))
+	binary.Write(fmtChunk, binary.LittleEndian, uint16(32))
+	if format == wavFormatExtensible {
+		binary.Write(fmtChunk, binary.LittleEndian, uint16(22))
+		binary.Write(fmtChunk, binary.LittleEndian, uint16(32))
+		binary.Write(fmtChunk, binary.LittleEndian, uint32(4))
+		binary.Write(fmtChunk, binary.LittleEndian, subFormat)
+		fmtChunk.Write(wavSubFormatGUID)
+	}
+
+	data := []byte{0, 0, 0x80, 0x3f, 0, 0, 0x80, 0xbf}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("RIFF")
+	binary.Write(buf, binary.LittleEndian, uint32(20+fmtChunk.Len()+len(data)))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(buf, binary.LittleEndian, uint32(fmtChunk.Len()))
+	buf.Write(fmtChunk.Bytes())
+	buf.WriteString("data")
+	binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+
+	return buf.Bytes()
+}
+
+func TestWAVDecoderFormats(t *testing.T) {
+	testcases := []struct {
+		name      string
+		format    uint16
+		subFormat uint16
+		err       error
+	}{
+		{name: "pcm", format: wavFormatPCM},
+		{name: "extensible pcm", format: wavFormatExtensible, subFormat: wavFormatPCM},
+		{name: "float", format: wavFormatFloat, err: ErrInvalidFormat},
+		{name: "extensible float", format: wavFormatExtensible, subFormat: wavFormatFloat, err: ErrInvalidFormat},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			pcm, err := WAVDecoder{}.Decode(bytes.NewReader(wavWithFormat(testcase.format, testcase.subFormat)))
+			assert.Equal(t, testcase.err, err)
+			if testcase.err == nil {
+				assert.Equal(t, testWAVSampleRate, pcm.SampleRate)
+				assert.Equal(t, []int16{0x3f80, -0x4080}, pcm.Samples)
+			}
+		})
+	}
+}
+
+// recordFPcalc records the fpcalc output of the audio test files, using the
+// fpcalc executable found in PATH:
+//
+//	go test ./pkg/fingerprint -run TestGoChromaPrintMatchesFPcalc -record-fpcalc
+var recordFPcalc = flag.Bool("record-fpcalc", false, "record the fpcalc output of the audio test files")
+
+func TestGoChromaPrintMatchesFPcalc(t *testing.T) {
+	files, err := ioutil.ReadDir(audioTestDataDir)
+	assert.NoError(t, err)
+
+	chromap := NewGoChromaPrint(afero.NewOsFs())
+
+	var compared int
+	for _, fInfo := range files {
+		if fInfo.IsDir() || !chromap.hasDecoder(filepath.Ext(fInfo.Name())) {
+			continue
+		}
+
+		audioPath := filepath.Join(audioTestDataDir, fInfo.Name())
+		if *recordFPcalc {
+			out, err := exec.Command("fpcalc", "-json", audioPath).Output()
+			if !assert.NoError(t, err, fInfo.Name()) {
+				continue
+			}
+			assert.NoError(t, ioutil.WriteFile(audioPath+fpcalcOutputExt, out, 0644))
+		}
+
+		recorded, err := ioutil.ReadFile(audioPath + fpcalcOutputExt)
+		if os.IsNotExist(err) {
+			t.Errorf("no fpcalc output recorded for %s, run the test with -record-fpcalc", fInfo.Name())
+			continue
+		}
+		assert.NoError(t, err)
+
+		var expected Fingerprint
+		assert.NoError(t, json.Unmarshal(recorded, &expected))
+
+		got, err := chromap.CalcFingerprint(audioPath)
+		assert.NoError(t, err)
+		assert.Len(t, got.Fingerprints, 1)
+		assert.Equal(t, expected.Value, got.Fingerprints[0].Value, fInfo.Name())
+		assert.InDelta(t, expected.Duration, got.Fingerprints[0].Duration, 0.01, fInfo.Name())
+
+		compared++
+	}
+
+	if compared == 0 {
+		t.Error("no audio file was compared with fpcalc")
+	}
+}
@@ -0,0 +1,155 @@
+package fingerprint
+
+import (
+	"sync"
+	"time"
+)
+
+// EventKind identifies the step of a scan a ProgressEvent reports
+type EventKind string
+
+const (
+	// EventDiscovered is reported for each file selected for fingerprinting
+	EventDiscovered EventKind = "discovered"
+	// EventFingerprinted is reported for each file fingerprinted successfully
+	EventFingerprinted EventKind = "fingerprinted"
+	// EventLookedUp is reported for each fingerprint looked up on AcoustID
+	EventLookedUp EventKind = "looked_up"
+	// EventFailed is reported for each file that couldn't be processed
+	EventFailed EventKind = "failed"
+)
+
+// ProgressEvent describes a step of a scan along with the counts of the events
+// reported so far. ETA estimates the time left to fingerprint the discovered
+// files, or to look up the fingerprinted ones once lookups have started. It is
+// 0 when unknown
+type ProgressEvent struct {
+	Kind EventKind
+	Path string
+	// Err is the cause of an EventFailed
+	Err error
+
+	Discovered    int
+	Fingerprinted int
+	LookedUp      int
+	Failed        int
+	Elapsed       time.Duration
+	ETA           time.Duration
+}
+
+// ProgressFunc receives the events of a ProgressTracker. It is never called
+// concurrently
+type ProgressFunc func(e ProgressEvent)
+
+// ProgressTracker counts the files processed by a scan and reports each step to
+// a ProgressFunc. The same tracker can be shared by the fingerprinting and the
+// lookup of the files. It is safe for concurrent use, and a nil *ProgressTracker
+// reports nothing
+type ProgressTracker struct {
+	mu sync.Mutex
+	fn ProgressFunc
+
+	start time.Time
+	// lookupStart is the time the last file was fingerprinted, when the lookups
+	// are expected to start
+	lookupStart time.Time
+	lookups     bool
+	// lookupFailed counts the failures reported after lookups started
+	lookupFailed int
+
+	discovered    int
+	fingerprinted int
+	lookedUp      int
+	failed        int
+}
+
+func NewProgressTracker(fn ProgressFunc) *ProgressTracker {
+	now := time.Now()
+
+	return &ProgressTracker{
+		fn:          fn,
+		start:       now,
+		lookupStart: now,
+	}
+}
+
+// Discovered reports a file selected for fingerprinting
+func (p *ProgressTracker) Discovered(path string) {
+	p.report(ProgressEvent{Kind: EventDiscovered, Path: path})
+}
+
+// Fingerprinted reports a file fingerprinted successfully
+func (p *ProgressTracker) Fingerprinted(path string) {
+	p.report(ProgressEvent{Kind: EventFingerprinted, Path: path})
+}
+
+// LookedUp reports a fingerprint looked up on AcoustID
+func (p *ProgressTracker) LookedUp(path string) {
+	p.report(ProgressEvent{Kind: EventLookedUp, Path: path})
+}
+
+// Failed reports a file that couldn't be fingerprinted or looked up
+func (p *ProgressTracker) Failed(path string, err error) {
+	p.report(ProgressEvent{Kind: EventFailed, Path: path, Err: err})
+}
+
+func (p *ProgressTracker) report(e ProgressEvent) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	switch e.Kind {
+	case EventDiscovered:
+		p.discovered++
+	case EventFingerprinted:
+		p.fingerprinted++
+		p.lookupStart = now
+	case EventLookedUp:
+		p.lookedUp++
+		p.lookups = true
+	case EventFailed:
+		p.failed++
+		if p.lookups {
+			p.lookupFailed++
+		} else {
+			p.lookupStart = now
+		}
+	}
+
+	e.Discovered = p.discovered
+	e.Fingerprinted = p.fingerprinted
+	e.LookedUp = p.lookedUp
+	e.Failed = p.failed
+	e.Elapsed = now.Sub(p.start)
+	e.ETA = p.eta(now)
+
+	if p.fn != nil {
+		p.fn(e)
+	}
+}
+
+// eta extrapolates the time left to the running stage from its average rate
+func (p *ProgressTracker) eta(now time.Time) time.Duration {
+	start, done, total := p.start, p.fingerprinted+p.failed, p.discovered
+	if p.lookups {
+		start, done, total = p.lookupStart, p.lookedUp+p.lookupFailed, p.fingerprinted
+	}
+
+	if done == 0 || done >= total {
+		return 0
+	}
+
+	perFile := float64(now.Sub(start)) / float64(done)
+	return time.Duration(perFile * float64(total-done))
+}
+
+// WithProgress reports the progress of the scans to tracker
+func WithProgress(tracker *ProgressTracker) ChromaPrintOption {
+	return func(c *ChromaPrint) {
+		c.progress = tracker
+	}
+}
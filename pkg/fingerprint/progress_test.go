@@ -0,0 +1,74 @@
+package fingerprint
+
+import (
+	"errors"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressTracker(t *testing.T) {
+	var events []ProgressEvent
+	tracker := NewProgressTracker(func(e ProgressEvent) { events = append(events, e) })
+
+	for _, p := range []string{"a", "b", "c", "d"} {
+		tracker.Discovered(p)
+	}
+	assert.Equal(t, time.Duration(0), events[3].ETA)
+
+	tracker.start = time.Now().Add(-2 * time.Second)
+	tracker.Fingerprinted("a")
+	tracker.Failed("b", ErrInvalidFormat)
+
+	last := events[len(events)-1]
+	assert.Equal(t, EventFailed, last.Kind)
+	assert.Equal(t, "b", last.Path)
+	assert.Equal(t, ErrInvalidFormat, last.Err)
+	assert.Equal(t, 4, last.Discovered)
+	assert.Equal(t, 1, last.Fingerprinted)
+	assert.Equal(t, 1, last.Failed)
+	// 2 files processed in 2 seconds, 2 left
+	assert.InDelta(t, 2*time.Second, last.ETA, float64(100*time.Millisecond))
+
+	tracker.Fingerprinted("c")
+	tracker.Fingerprinted("d")
+	assert.Equal(t, time.Duration(0), events[len(events)-1].ETA)
+
+	// lookups estimate the time left to look up the fingerprinted files
+	tracker.lookupStart = time.Now().Add(-time.Second)
+	tracker.LookedUp("a")
+	last = events[len(events)-1]
+	assert.Equal(t, EventLookedUp, last.Kind)
+	assert.Equal(t, 1, last.LookedUp)
+	assert.InDelta(t, 2*time.Second, last.ETA, float64(100*time.Millisecond))
+}
+
+func TestProgressTrackerNil(t *testing.T) {
+	var tracker *ProgressTracker
+	tracker.Discovered("a")
+	tracker.Failed("a", errors.New("failed"))
+}
+
+func TestScanProgress(t *testing.T) {
+	mockFS := mustSetupFS()
+	assert.NoError(t, afero.WriteFile(mockFS, path.Join(testDataDir, "broken.mp3"), []byte("text"), 0644))
+
+	counts := map[EventKind]int{}
+	var last ProgressEvent
+	tracker := NewProgressTracker(func(e ProgressEvent) {
+		counts[e.Kind]++
+		last = e
+	})
+
+	chromap := mustNewChromaPrint(mockExec(t), mockFS, WithProgress(tracker))
+	_, err := chromap.CalcFingerprint(testDataDir)
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[EventKind]int{EventDiscovered: 3, EventFingerprinted: 2, EventFailed: 1}, counts)
+	assert.Equal(t, 3, last.Discovered)
+	assert.Equal(t, 2, last.Fingerprinted)
+	assert.Equal(t, 1, last.Failed)
+}
@@ -0,0 +1,186 @@
+package fingerprint
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// audioFile is a file selected for fingerprinting
+type audioFile struct {
+	info      os.FileInfo
+	path      string
+	relPath   string
+	container Container
+}
+
+// result is the product of reading a file and extracting its adio fingerprint
+type result struct {
+	path   string
+	fprint *Fingerprint
+	err    error
+}
+
+// detectFunc returns the container of the file at fPath or ErrInvalidFormat if
+// the file can't be fingerprinted
+type detectFunc func(fInfo os.FileInfo, fPath string) (Container, error)
+
+// fileFingerprintFunc calculates the fingerprint of a single audio file. It must
+// return when ctx is done
+type fileFingerprintFunc func(ctx context.Context, f audioFile) (*Fingerprint, error)
+
+// scanner finds the audio files in an input path and fingerprints them with a
+// bounded pool of workers
+type scanner struct {
+	fs          afero.Fs
+	walk        walkOptions
+	concurrency int
+	// timeout limits the time spent fingerprinting each file, 0 means no limit
+	timeout time.Duration
+	detect  detectFunc
+	calc    fileFingerprintFunc
+
+	// isAudioName reports whether a file name looks like a supported audio file.
+	// Such files are reported as failures, instead of being skipped, when
+	// detect rejects them
+	isAudioName func(name string) bool
+
+	// calcReader fingerprints the audio read from a stream. Archives are only
+	// scanned when it is set, their entries being streamed to it
+	calcReader func(ctx context.Context, r io.Reader) (*Fingerprint, error)
+	archive    archiveLimits
+
+	progress *ProgressTracker
+}
+
+// scanDir scans the directory at dirPath and concurrently extracts fingerprints.
+// Files rejected by detect will be ignored. Subdirectories are scanned according
+// to the walk options. When ctx is done the files fingerprinted so far are
+// returned along with the ctx error
+func (s *scanner) scanDir(ctx context.Context, dirPath string) (*BatchResult, error) {
+	files, failures, err := listAudioFiles(s.fs, dirPath, s.walk, s.detect, s.isAudioName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, failure := range failures {
+		s.progress.Discovered(failure.Path)
+		s.progress.Failed(failure.Path, failure)
+	}
+	for _, f := range files {
+		s.progress.Discovered(f.path)
+	}
+
+	res, err := s.fingerprintFiles(ctx, files)
+	res.Failures = append(failures, res.Failures...)
+
+	return res, err
+}
+
+func (s *scanner) scanFile(ctx context.Context, fInfo os.FileInfo, fPath string) (*BatchResult, error) {
+	container, err := s.detect(fInfo, fPath)
+	if err != nil {
+		return nil, err
+	}
+
+	f := audioFile{info: fInfo, path: fPath, relPath: fInfo.Name(), container: container}
+	s.progress.Discovered(fPath)
+
+	fing, err := s.calcFile(ctx, f)
+	if err != nil {
+		s.progress.Failed(fPath, err)
+		return nil, err
+	}
+	s.progress.Fingerprinted(fPath)
+
+	return &BatchResult{Fingerprints: []*Fingerprint{fing}}, nil
+}
+
+// calcFile fingerprints f, applying the scanner timeout. Errors are returned as
+// *FileError
+func (s *scanner) calcFile(ctx context.Context, f audioFile) (*Fingerprint, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	fing, err := s.calc(ctx, f)
+	if err != nil {
+		return nil, newFileError(f, err)
+	}
+
+	fing.RelPath = f.relPath
+	if fing.Source == nil {
+		fing.Source, err = newSource(s.fs, f)
+		if err != nil {
+			return nil, newFileError(f, err)
+		}
+	}
+
+	return fing, nil
+}
+
+// fingerprintFiles fingerprints files with at most s.concurrency workers. Files
+// that can't be fingerprinted are reported as failures. When ctx is done no more
+// files are fingerprinted and the ctx error is returned with the partial result
+func (s *scanner) fingerprintFiles(ctx context.Context, files []audioFile) (*BatchResult, error) {
+	jobs := make(chan audioFile)
+	fChan := make(chan result)
+
+	go func() {
+		defer close(jobs)
+		for _, f := range files {
+			select {
+			case jobs <- f:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	workers := s.concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(files) {
+		workers = len(files)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for f := range jobs {
+				fing, err := s.calcFile(ctx, f)
+				fChan <- result{path: f.path, fprint: fing, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(fChan)
+	}()
+
+	// collect results
+	res := &BatchResult{Fingerprints: []*Fingerprint{}}
+	for result := range fChan {
+		if result.err != nil {
+			s.progress.Failed(result.path, result.err)
+			res.Failures = append(res.Failures, result.err.(*FileError))
+			continue
+		}
+
+		s.progress.Fingerprinted(result.path)
+		res.Fingerprints = append(res.Fingerprints, result.fprint)
+	}
+
+	return res, ctx.Err()
+}
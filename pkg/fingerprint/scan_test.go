@@ -0,0 +1,153 @@
+package fingerprint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// testAudioFiles writes n files to a new in memory file system
+func testAudioFiles(n int) (afero.Fs, []audioFile) {
+	fs := afero.NewMemMapFs()
+	files := make([]audioFile, n)
+	for i := range files {
+		p := fmt.Sprint("/", i)
+		if err := afero.WriteFile(fs, p, []byte(p), 0644); err != nil {
+			panic(err)
+		}
+
+		info, err := fs.Stat(p)
+		if err != nil {
+			panic(err)
+		}
+
+		files[i] = audioFile{info: info, path: p, relPath: fmt.Sprint(i)}
+	}
+
+	return fs, files
+}
+
+func TestFingerprintFilesConcurrencyLimit(t *testing.T) {
+	var inFlight, maxInFlight int32
+	var mu sync.Mutex
+
+	fs, files := testAudioFiles(20)
+	s := &scanner{
+		fs:          fs,
+		concurrency: 3,
+		calc: func(ctx context.Context, f audioFile) (*Fingerprint, error) {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+
+			mu.Lock()
+			if n > maxInFlight {
+				maxInFlight = n
+			}
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+			return &Fingerprint{Value: f.path}, nil
+		},
+	}
+
+	got, err := s.fingerprintFiles(context.Background(), files)
+	assert.NoError(t, err)
+	assert.Len(t, got.Fingerprints, 20)
+	assert.Empty(t, got.Failures)
+	assert.True(t, maxInFlight <= 3, "max in flight %d", maxInFlight)
+}
+
+func TestFingerprintFilesReportsFailures(t *testing.T) {
+	corruptErr := errors.New("corrupt file")
+
+	fs, files := testAudioFiles(10)
+	s := &scanner{
+		fs:          fs,
+		concurrency: 2,
+		calc: func(ctx context.Context, f audioFile) (*Fingerprint, error) {
+			if f.relPath == "3" {
+				return nil, corruptErr
+			}
+
+			return &Fingerprint{Value: f.path}, nil
+		},
+	}
+
+	got, err := s.fingerprintFiles(context.Background(), files)
+	assert.NoError(t, err)
+	assert.Len(t, got.Fingerprints, 9)
+	assert.Equal(t, []*FileError{
+		{Path: "/3", RelPath: "3", Kind: FailureUnknown, Err: corruptErr},
+	}, got.Failures)
+}
+
+func TestFingerprintFilesCancel(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var calls int32
+	fs, files := testAudioFiles(100)
+	s := &scanner{
+		fs:          fs,
+		concurrency: 2,
+		calc: func(ctx context.Context, f audioFile) (*Fingerprint, error) {
+			n := atomic.AddInt32(&calls, 1)
+			if n < 3 {
+				return &Fingerprint{Value: f.path}, nil
+			}
+			if n == 3 {
+				cancel()
+			}
+
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+
+	got, err := s.fingerprintFiles(ctx, files)
+	assert.Equal(t, context.Canceled, err)
+	assert.Len(t, got.Fingerprints, 2)
+	assert.True(t, atomic.LoadInt32(&calls) < 100, "calls %d", calls)
+	for _, failure := range got.Failures {
+		assert.Equal(t, FailureCanceled, failure.Kind)
+	}
+
+	// the producer and the workers must have returned
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, runtime.NumGoroutine() <= goroutines, "leaked %d goroutines", runtime.NumGoroutine()-goroutines)
+}
+
+func TestFingerprintFilesTimeout(t *testing.T) {
+	fs, files := testAudioFiles(4)
+	s := &scanner{
+		fs:          fs,
+		concurrency: 2,
+		timeout:     10 * time.Millisecond,
+		calc: func(ctx context.Context, f audioFile) (*Fingerprint, error) {
+			if f.relPath == "1" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+
+			return &Fingerprint{Value: f.path}, nil
+		},
+	}
+
+	got, err := s.fingerprintFiles(context.Background(), files)
+	assert.NoError(t, err)
+	assert.Len(t, got.Fingerprints, 3)
+	assert.Len(t, got.Failures, 1)
+	assert.Equal(t, "/1", got.Failures[0].Path)
+	assert.Equal(t, FailureTimeout, got.Failures[0].Kind)
+}
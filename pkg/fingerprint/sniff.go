@@ -0,0 +1,220 @@
+package fingerprint
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/spf13/afero"
+)
+
+// Container is an audio container format detected from the content of a file
+type Container string
+
+const (
+	ContainerMP3  Container = "mp3"
+	ContainerAAC  Container = "aac"
+	ContainerFLAC Container = "flac"
+	ContainerWAV  Container = "wav"
+	ContainerAIFF Container = "aiff"
+	ContainerOgg  Container = "ogg"
+	ContainerMP4  Container = "mp4"
+)
+
+// containerExtensions are the file extensions associated with each container.
+// They are matched against the audio formats a Fingerprinter is configured with
+var containerExtensions = map[Container][]string{
+	ContainerMP3:  {".mp3"},
+	ContainerAAC:  {".aac"},
+	ContainerFLAC: {".flac"},
+	ContainerWAV:  {".wav"},
+	ContainerAIFF: {".aif", ".aiff"},
+	ContainerOgg:  {".ogg", ".oga", ".opus"},
+	ContainerMP4:  {".m4a", ".mp4"},
+}
+
+const (
+	// sniffLen is enough to read the brands of the ftyp box of most MP4 files
+	sniffLen     = 64
+	id3HeaderLen = 10
+)
+
+// mp4AudioBrands are the ISO-BMFF brands of files that can hold audio tracks.
+// Generic brands like isom and mp42 are accepted too, even if they can't tell
+// audio files from videos
+var mp4AudioBrands = map[string]bool{
+	"M4A ": true,
+	"M4B ": true,
+	"M4P ": true,
+	"F4A ": true,
+	"F4B ": true,
+	"mp41": true,
+	"mp42": true,
+	"isom": true,
+	"iso2": true,
+	"dash": true,
+}
+
+// mp4ImageBrands are the ISO-BMFF brands of HEIF and AVIF images
+var mp4ImageBrands = map[string]bool{
+	"mif1": true,
+	"msf1": true,
+	"heic": true,
+	"heix": true,
+	"heim": true,
+	"heis": true,
+	"hevc": true,
+	"hevx": true,
+	"avif": true,
+	"avis": true,
+}
+
+// sniffContainer detects the audio container of the file at fPath from its
+// magic bytes. ErrInvalidFormat is returned if the content isn't recognised
+func sniffContainer(fs afero.Fs, fPath string) (Container, error) {
+	f, err := fs.Open(fPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header, err := readHeader(f)
+	if err != nil {
+		return "", err
+	}
+
+	// ID3v2 tags are mostly found in mp3 files but can prefix other formats too,
+	// so the content following the tag is checked as well
+	if bytes.HasPrefix(header, []byte("ID3")) && len(header) >= id3HeaderLen {
+		tagLen := id3HeaderLen + syncsafeInt(header[6:10])
+		if header[5]&0x10 != 0 {
+			tagLen += id3HeaderLen // footer
+		}
+
+		if _, err := f.Seek(int64(tagLen), io.SeekStart); err != nil {
+			return "", err
+		}
+
+		afterTag, err := readHeader(f)
+		if err != nil {
+			return "", err
+		}
+
+		if container, ok := containerFromHeader(afterTag); ok {
+			return container, nil
+		}
+
+		return ContainerMP3, nil
+	}
+
+	if container, ok := containerFromHeader(header); ok {
+		return container, nil
+	}
+
+	return "", ErrInvalidFormat
+}
+
+// sniffReader detects the audio container of the stream read by br without
+// consuming it. The content following ID3v2 tags isn't checked, so tagged
+// streams are reported as ContainerMP3
+func sniffReader(br *bufio.Reader) (Container, error) {
+	header, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	if bytes.HasPrefix(header, []byte("ID3")) {
+		return ContainerMP3, nil
+	}
+
+	if container, ok := containerFromHeader(header); ok {
+		return container, nil
+	}
+
+	return "", ErrInvalidFormat
+}
+
+// readHeader returns up to sniffLen bytes from r
+func readHeader(r io.Reader) ([]byte, error) {
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	return header[:n], nil
+}
+
+func containerFromHeader(h []byte) (Container, bool) {
+	switch {
+	case bytes.HasPrefix(h, []byte("fLaC")):
+		return ContainerFLAC, true
+	case bytes.HasPrefix(h, []byte("OggS")):
+		return ContainerOgg, true
+	case len(h) >= 12 && string(h[0:4]) == "RIFF" && string(h[8:12]) == "WAVE":
+		return ContainerWAV, true
+	case len(h) >= 12 && string(h[0:4]) == "FORM" && (string(h[8:12]) == "AIFF" || string(h[8:12]) == "AIFC"):
+		return ContainerAIFF, true
+	case len(h) >= 12 && string(h[4:8]) == "ftyp":
+		return ContainerMP4, isAudioFtyp(h)
+	case len(h) >= 2 && h[0] == 0xff && h[1]&0xe0 == 0xe0:
+		return mpegContainer(h[1])
+	}
+
+	return "", false
+}
+
+// isAudioFtyp reports whether the ftyp box at the beginning of h has an audio
+// brand among its major and compatible brands, and no image brand
+func isAudioFtyp(h []byte) bool {
+	end := int(binary.BigEndian.Uint32(h[0:4]))
+	if end > len(h) {
+		end = len(h)
+	}
+
+	// the major brand is followed by the minor version and the compatible brands
+	brands := []string{string(h[8:12])}
+	for i := 16; i+4 <= end; i += 4 {
+		brands = append(brands, string(h[i:i+4]))
+	}
+
+	audio := false
+	for _, brand := range brands {
+		if mp4ImageBrands[brand] {
+			return false
+		}
+		if mp4AudioBrands[brand] {
+			audio = true
+		}
+	}
+
+	return audio
+}
+
+// mpegContainer distinguishes MPEG audio frames from AAC ADTS frames using the
+// second byte of the frame sync header
+func mpegContainer(b byte) (Container, bool) {
+	version := (b >> 3) & 0x03
+	layer := (b >> 1) & 0x03
+
+	if layer == 0 {
+		// ADTS headers have a 12 bit sync word and layer set to 0
+		if b&0xf0 == 0xf0 {
+			return ContainerAAC, true
+		}
+		return "", false
+	}
+
+	// version 01 is reserved
+	if version == 0x01 {
+		return "", false
+	}
+
+	return ContainerMP3, true
+}
+
+// syncsafeInt decodes the 28 bit integers used in ID3v2 headers
+func syncsafeInt(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
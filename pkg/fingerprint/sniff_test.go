@@ -0,0 +1,82 @@
+package fingerprint
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSniffContainer(t *testing.T) {
+	testcases := []struct {
+		name        string
+		fileName    string
+		content     []byte
+		expected    Container
+		expectedErr error
+	}{
+		{name: "mp3 frame sync", fileName: "track.mp3", content: mp3Header, expected: ContainerMP3},
+		{name: "mp3 with id3 tag", fileName: "track.mp3", content: append([]byte("ID3\x04\x00\x00\x00\x00\x00\x02\x00\x00"), mp3Header...), expected: ContainerMP3},
+		{name: "flac with id3 tag", fileName: "track.flac", content: []byte("ID3\x04\x00\x00\x00\x00\x00\x00fLaC"), expected: ContainerFLAC},
+		{name: "aac adts", fileName: "track.aac", content: []byte{0xff, 0xf1, 0x50, 0x80}, expected: ContainerAAC},
+		{name: "flac", fileName: "track.flac", content: []byte("fLaC\x00\x00\x00\x22"), expected: ContainerFLAC},
+		{name: "wav", fileName: "track.wav", content: []byte("RIFF\x24\x00\x00\x00WAVEfmt "), expected: ContainerWAV},
+		{name: "aiff", fileName: "track.aiff", content: []byte("FORM\x00\x00\x00\x00AIFF"), expected: ContainerAIFF},
+		{name: "ogg", fileName: "track.opus", content: []byte("OggS\x00\x02"), expected: ContainerOgg},
+		{name: "m4a", fileName: "track.m4a", content: []byte("\x00\x00\x00\x20ftypM4A \x00\x00\x02\x00M4A mp42isom\x00\x00\x00\x00"), expected: ContainerMP4},
+		{name: "m4b", fileName: "book.m4b", content: []byte("\x00\x00\x00\x18ftypM4B \x00\x00\x02\x00M4B isom"), expected: ContainerMP4},
+		{name: "mp4", fileName: "track.mp4", content: []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), expected: ContainerMP4},
+		{name: "unknown mp4 brand", fileName: "clip.mp4", content: []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x02\x00qt  "), expectedErr: ErrInvalidFormat},
+		{name: "heic image", fileName: "photo.heic", content: []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"), expectedErr: ErrInvalidFormat},
+		{name: "avif image", fileName: "photo.mp4", content: []byte("\x00\x00\x00\x20ftypavif\x00\x00\x00\x00avifmif1miafMA1B"), expectedErr: ErrInvalidFormat},
+		{name: "image with generic brand", fileName: "photo.m4a", content: []byte("\x00\x00\x00\x1cftypmif1\x00\x00\x00\x00mif1heicisom"), expectedErr: ErrInvalidFormat},
+		{name: "misnamed file", fileName: "track.txt", content: []byte("fLaC"), expected: ContainerFLAC},
+		{name: "extensionless file", fileName: "download", content: mp3Header, expected: ContainerMP3},
+		{name: "avi riff", fileName: "video.avi", content: []byte("RIFF\x24\x00\x00\x00AVI LIST"), expectedErr: ErrInvalidFormat},
+		{name: "text file", fileName: "track.mp3", content: []byte("not audio"), expectedErr: ErrInvalidFormat},
+		{name: "empty file", fileName: "track.mp3", content: []byte{}, expectedErr: ErrInvalidFormat},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			mockFS := afero.NewMemMapFs()
+			assert.NoError(t, afero.WriteFile(mockFS, testcase.fileName, testcase.content, 0644))
+
+			got, err := sniffContainer(mockFS, testcase.fileName)
+			assert.Equal(t, testcase.expectedErr, err)
+			assert.Equal(t, testcase.expected, got)
+		})
+	}
+}
+
+func TestSniffReader(t *testing.T) {
+	testcases := []struct {
+		name        string
+		content     []byte
+		expected    Container
+		expectedErr error
+	}{
+		{name: "mp3", content: mp3Header, expected: ContainerMP3},
+		{name: "id3 tag", content: []byte("ID3\x04\x00\x00\x00\x00\x00\x00fLaC"), expected: ContainerMP3},
+		{name: "wav", content: []byte("RIFF\x24\x00\x00\x00WAVEfmt "), expected: ContainerWAV},
+		{name: "text", content: []byte("not audio"), expectedErr: ErrInvalidFormat},
+		{name: "empty", content: []byte{}, expectedErr: ErrInvalidFormat},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			br := bufio.NewReader(bytes.NewReader(testcase.content))
+			got, err := sniffReader(br)
+			assert.Equal(t, testcase.expectedErr, err)
+			assert.Equal(t, testcase.expected, got)
+
+			// the sniffed bytes are still available
+			rest, err := ioutil.ReadAll(br)
+			assert.NoError(t, err)
+			assert.Equal(t, testcase.content, rest)
+		})
+	}
+}
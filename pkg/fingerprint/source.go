@@ -0,0 +1,82 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Source describes the file a Fingerprint was calculated from. Hash is the hex
+// encoded SHA-256 digest of the file content, so that files can be identified
+// after being renamed or moved. For the files stored in an archive Path is the
+// archive path and Entry the file name inside it
+type Source struct {
+	Path    string    `json:"path"`
+	Entry   string    `json:"entry,omitempty"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"sha256"`
+}
+
+// newSource returns the Source of the audio file f, hashing its content
+func newSource(fs afero.Fs, f audioFile) (*Source, error) {
+	absPath, err := filepath.Abs(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := fs.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+
+	return &Source{
+		Path:    absPath,
+		Size:    f.info.Size(),
+		ModTime: f.info.ModTime().UTC(),
+		Hash:    hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// sourceReader calculates the Source of a stream while it is read
+type sourceReader struct {
+	r    io.Reader
+	h    hash.Hash
+	size int64
+}
+
+func newSourceReader(r io.Reader) *sourceReader {
+	return &sourceReader{r: r, h: sha256.New()}
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.h.Write(p[:n])
+	s.size += int64(n)
+
+	return n, err
+}
+
+// source reads the rest of the stream and returns its Source
+func (s *sourceReader) source() (*Source, error) {
+	if _, err := io.Copy(ioutil.Discard, s); err != nil {
+		return nil, err
+	}
+
+	return &Source{
+		Size: s.size,
+		Hash: hex.EncodeToString(s.h.Sum(nil)),
+	}, nil
+}
@@ -0,0 +1,236 @@
+package fingerprint
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// walkOptions controls how a directory tree is traversed when looking for audio
+// files. The zero value only lists the top level directory
+type walkOptions struct {
+	recursive      bool
+	maxDepth       int
+	include        []string
+	exclude        []string
+	followSymlinks bool
+}
+
+// WithRecursion makes ChromaPrint scan subdirectories. maxDepth limits how many
+// directory levels below the input path are scanned, 0 means no limit
+func WithRecursion(maxDepth int) ChromaPrintOption {
+	return func(c *ChromaPrint) {
+		c.walk.recursive = true
+		c.walk.maxDepth = maxDepth
+	}
+}
+
+// WithIncludePatterns restricts the scanned files to the ones matching at least
+// one of the glob patterns. See WithExcludePatterns for the matching rules
+func WithIncludePatterns(patterns ...string) ChromaPrintOption {
+	return func(c *ChromaPrint) {
+		c.walk.include = patterns
+	}
+}
+
+// WithExcludePatterns skips the files and directories matching any of the glob
+// patterns. Patterns use the path.Match syntax. Patterns containing a "/" are
+// matched against the path relative to the scanned directory, the other ones
+// against the file or directory name
+func WithExcludePatterns(patterns ...string) ChromaPrintOption {
+	return func(c *ChromaPrint) {
+		c.walk.exclude = patterns
+	}
+}
+
+// WithFollowSymlinks sets whether symbolic links are followed when scanning a
+// directory. Symbolic links are skipped by default
+func WithFollowSymlinks(follow bool) ChromaPrintOption {
+	return func(c *ChromaPrint) {
+		c.walk.followSymlinks = follow
+	}
+}
+
+// walker collects the audio files found while walking a directory tree
+type walker struct {
+	fs          afero.Fs
+	root        string
+	opts        walkOptions
+	detect      detectFunc
+	isAudioName func(name string) bool
+
+	files    []audioFile
+	failures []*FileError
+	// visited holds the root and the directories reached through symbolic links.
+	// It is used to avoid walking symbolic link cycles
+	visited []os.FileInfo
+}
+
+// listAudioFiles walks the directory tree rooted at root and returns the files
+// accepted by detect. Files named like audio files that detect rejects or that
+// can't be read are returned as failures
+func listAudioFiles(fs afero.Fs, root string, opts walkOptions, detect detectFunc, isAudioName func(string) bool) ([]audioFile, []*FileError, error) {
+	for _, pattern := range append(opts.include, opts.exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	rootInfo, err := fs.Stat(root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := &walker{
+		fs:          fs,
+		root:        root,
+		opts:        opts,
+		detect:      detect,
+		isAudioName: isAudioName,
+		visited:     []os.FileInfo{rootInfo},
+	}
+
+	if err := afero.Walk(fs, root, w.visit); err != nil {
+		return nil, nil, err
+	}
+
+	return w.files, w.failures, nil
+}
+
+func (w *walker) visit(fPath string, info os.FileInfo, err error) error {
+	rel, relErr := filepath.Rel(w.root, fPath)
+	if relErr != nil {
+		return relErr
+	}
+	rel = filepath.ToSlash(rel)
+
+	if err != nil {
+		if rel == "." {
+			return err
+		}
+
+		// unreadable subdirectories and files don't stop the scan
+		w.failures = append(w.failures, newFileError(audioFile{path: fPath, relPath: rel}, err))
+		return nil
+	}
+
+	if rel == "." {
+		return nil
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		if !w.opts.followSymlinks {
+			return nil
+		}
+
+		return w.visitSymlink(fPath, rel)
+	}
+
+	if info.IsDir() {
+		if !w.enterDir(rel) {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+
+	return w.addFile(info, fPath, rel)
+}
+
+// enterDir reports whether the directory at the rel path should be scanned
+func (w *walker) enterDir(rel string) bool {
+	if !w.opts.recursive {
+		return false
+	}
+
+	if w.opts.maxDepth > 0 && strings.Count(rel, "/")+1 > w.opts.maxDepth {
+		return false
+	}
+
+	return !matchesAny(w.opts.exclude, rel)
+}
+
+func (w *walker) visitSymlink(fPath string, rel string) error {
+	target, err := w.fs.Stat(fPath)
+	if err != nil {
+		// broken links are ignored
+		return nil
+	}
+
+	if !target.IsDir() {
+		return w.addFile(target, fPath, rel)
+	}
+
+	if !w.enterDir(rel) {
+		return nil
+	}
+
+	for _, v := range w.visited {
+		if os.SameFile(v, target) {
+			return nil
+		}
+	}
+	w.visited = append(w.visited, target)
+
+	// afero.Walk doesn't follow a symbolic link passed as its root, so the
+	// linked directory entries are walked one by one
+	entries, err := afero.ReadDir(w.fs, fPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := afero.Walk(w.fs, filepath.Join(fPath, entry.Name()), w.visit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *walker) addFile(info os.FileInfo, fPath string, rel string) error {
+	if matchesAny(w.opts.exclude, rel) {
+		return nil
+	}
+
+	if len(w.opts.include) > 0 && !matchesAny(w.opts.include, rel) {
+		return nil
+	}
+
+	f := audioFile{info: info, path: fPath, relPath: rel}
+
+	container, err := w.detect(info, fPath)
+	if err != nil {
+		if errors.Is(err, ErrInvalidFormat) && (w.isAudioName == nil || !w.isAudioName(info.Name())) {
+			return nil
+		}
+
+		w.failures = append(w.failures, newFileError(f, err))
+		return nil
+	}
+
+	f.container = container
+	w.files = append(w.files, f)
+
+	return nil
+}
+
+// matchesAny reports whether the slash separated rel path matches any of the
+// glob patterns
+func matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,144 @@
+package fingerprint
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+const libraryDir = "/library"
+
+func mustSetupLibraryFS() afero.Fs {
+	mockFS := afero.NewMemMapFs()
+	files := []string{
+		"loose.mp3",
+		"notes.txt",
+		"Artist/Album/cover.jpg",
+		"Artist/Album/Disc 1/01 - intro.mp3",
+		"Artist/Album/Disc 1/02 - song.flac",
+		"Artist/Album/Disc 2/01 - outro.mp3",
+		"Artist/Album/Bonus/demo.mp3",
+	}
+
+	for _, f := range files {
+		content := mp3Header
+		if path.Ext(f) == ".flac" {
+			content = []byte("fLaC")
+		} else if path.Ext(f) != ".mp3" {
+			content = []byte("not audio")
+		}
+
+		if err := afero.WriteFile(mockFS, path.Join(libraryDir, f), content, 0644); err != nil {
+			panic(err)
+		}
+	}
+
+	return mockFS
+}
+
+func relPaths(files []audioFile) []string {
+	paths := []string{}
+	for _, f := range files {
+		paths = append(paths, f.relPath)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+func TestListAudioFiles(t *testing.T) {
+	testcases := []struct {
+		name     string
+		opts     []ChromaPrintOption
+		expected []string
+	}{
+		{
+			name:     "top level only",
+			expected: []string{"loose.mp3"},
+		},
+		{
+			name: "recursive",
+			opts: []ChromaPrintOption{WithRecursion(0)},
+			expected: []string{
+				"Artist/Album/Bonus/demo.mp3",
+				"Artist/Album/Disc 1/01 - intro.mp3",
+				"Artist/Album/Disc 1/02 - song.flac",
+				"Artist/Album/Disc 2/01 - outro.mp3",
+				"loose.mp3",
+			},
+		},
+		{
+			name:     "max depth",
+			opts:     []ChromaPrintOption{WithRecursion(2)},
+			expected: []string{"loose.mp3"},
+		},
+		{
+			name: "include patterns",
+			opts: []ChromaPrintOption{WithRecursion(0), WithIncludePatterns("*.flac", "Artist/Album/Bonus/*")},
+			expected: []string{
+				"Artist/Album/Bonus/demo.mp3",
+				"Artist/Album/Disc 1/02 - song.flac",
+			},
+		},
+		{
+			name: "exclude directories and files",
+			opts: []ChromaPrintOption{WithRecursion(0), WithExcludePatterns("Bonus", "01 - *")},
+			expected: []string{
+				"Artist/Album/Disc 1/02 - song.flac",
+				"loose.mp3",
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			mockFS := mustSetupLibraryFS()
+			chromap := mustNewChromaPrint(mockExec(t), mockFS, testcase.opts...)
+
+			got, _, err := listAudioFiles(mockFS, libraryDir, chromap.walk, chromap.detectAudio, chromap.isAudioName)
+			assert.NoError(t, err)
+			assert.Equal(t, testcase.expected, relPaths(got))
+		})
+	}
+}
+
+func TestListAudioFilesInvalidPattern(t *testing.T) {
+	mockFS := mustSetupLibraryFS()
+	chromap := mustNewChromaPrint(mockExec(t), mockFS, WithExcludePatterns("[a-"))
+
+	_, _, err := listAudioFiles(mockFS, libraryDir, chromap.walk, chromap.detectAudio, chromap.isAudioName)
+	assert.Equal(t, path.ErrBadPattern, err)
+}
+
+func TestListAudioFilesSymlinks(t *testing.T) {
+	root, err := ioutil.TempDir("", "fingerprinter")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	shared, err := ioutil.TempDir("", "fingerprinter-shared")
+	assert.NoError(t, err)
+	defer os.RemoveAll(shared)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "track.mp3"), mp3Header, 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(shared, "shared.mp3"), mp3Header, 0644))
+	assert.NoError(t, os.Symlink(shared, filepath.Join(root, "linked")))
+	assert.NoError(t, os.Symlink(root, filepath.Join(shared, "cycle")))
+
+	osFS := afero.NewOsFs()
+
+	chromap := mustNewChromaPrint(mockExec(t), osFS, WithRecursion(0))
+	got, _, err := listAudioFiles(osFS, root, chromap.walk, chromap.detectAudio, chromap.isAudioName)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"track.mp3"}, relPaths(got))
+
+	chromap = mustNewChromaPrint(mockExec(t), osFS, WithRecursion(0), WithFollowSymlinks(true))
+	got, _, err = listAudioFiles(osFS, root, chromap.walk, chromap.detectAudio, chromap.isAudioName)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"linked/shared.mp3", "track.mp3"}, relPaths(got))
+}
@@ -9,13 +9,16 @@ import (
 	"time"
 
 	hc "github.com/ocramh/fingerprinter/internal/httpclient"
+	"github.com/ocramh/fingerprinter/internal/ratelimit"
 	mb "github.com/ocramh/fingerprinter/pkg/musicbrainz/types"
 )
 
 const (
 	MusicBrainzRecordingURL = "https://musicbrainz.org/ws/2/recording"
 	MusicBrainzReleaseURL   = "https://musicbrainz.org/ws/2/release"
-	MusicBrainzReqDelay     = 1 * time.Second // MusicBrainz allows one request per second
+
+	// DefaultRateLimit is the number of requests per second allowed by the API
+	DefaultRateLimit = 1
 )
 
 var (
@@ -34,14 +37,53 @@ type MusicBrainz struct {
 	appName      string
 	appSemVer    string
 	contactEmail string
+	limiter      *ratelimit.Limiter
+}
+
+// Option configures optional MusicBrainz settings
+type Option func(*rateConfig)
+
+// rateConfig collects the rate limit options
+type rateConfig struct {
+	requests int
+	per      time.Duration
+	lockFile string
+}
+
+// WithRateLimit sets the number of requests sent per period, DefaultRateLimit per
+// second by default. Requests exceeding it wait for their turn
+func WithRateLimit(requests int, per time.Duration) Option {
+	return func(c *rateConfig) {
+		c.requests = requests
+		c.per = per
+	}
+}
+
+// WithRateLimitLockFile shares the rate limit with the other processes of the
+// host using the same lock file
+func WithRateLimitLockFile(path string) Option {
+	return func(c *rateConfig) {
+		c.lockFile = path
+	}
 }
 
 // NewMusicBrainz is the MBHTTPClient constructor
-func NewMusicBrainz(appName string, appSemVer string, email string) *MusicBrainz {
+func NewMusicBrainz(appName string, appSemVer string, email string, opts ...Option) *MusicBrainz {
+	cfg := rateConfig{requests: DefaultRateLimit, per: time.Second}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	limiter := ratelimit.New(cfg.requests, cfg.per)
+	if cfg.lockFile != "" {
+		limiter = ratelimit.NewShared(cfg.requests, cfg.per, cfg.lockFile)
+	}
+
 	return &MusicBrainz{
 		appName:      appName,
 		appSemVer:    appSemVer,
 		contactEmail: email,
+		limiter:      limiter,
 	}
 }
 
@@ -55,8 +97,7 @@ func (m *MusicBrainz) GetRecordingInfo(recordingID string) (*mb.RecordingInfo, e
 	}
 	req.Header.Add("Content-Type", "application/json")
 
-	httpClient := hc.NewClient()
-	resp, err := httpClient.Do(req)
+	resp, err := m.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -84,8 +125,7 @@ func (m *MusicBrainz) GetReleaseInfo(releaseID string) (*mb.ReleaseInfo, error)
 	}
 	req.Header.Add("Content-Type", "application/json")
 
-	httpClient := hc.NewClient()
-	resp, err := httpClient.Do(req)
+	resp, err := m.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -104,6 +144,15 @@ func (m *MusicBrainz) GetReleaseInfo(releaseID string) (*mb.ReleaseInfo, error)
 	return &relInfo, nil
 }
 
+// do sends req once the rate limit allows it
+func (m *MusicBrainz) do(req *http.Request) (*http.Response, error) {
+	if err := m.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	return hc.NewClient().Do(req)
+}
+
 func (m *MusicBrainz) handleMBErrResp(r *http.Response) error {
 	var errResp mb.MBError
 	err := json.NewDecoder(r.Body).Decode(&errResp)
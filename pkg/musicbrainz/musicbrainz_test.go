@@ -7,11 +7,13 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/assert"
 
 	hc "github.com/ocramh/fingerprinter/internal/httpclient"
+	"github.com/ocramh/fingerprinter/internal/ratelimit"
 )
 
 var (
@@ -27,6 +29,7 @@ func TestNewMusicBrainzClient(t *testing.T) {
 		appName:      testAppName,
 		appSemVer:    testAppVersion,
 		contactEmail: testEmail,
+		limiter:      ratelimit.New(DefaultRateLimit, time.Second),
 	}, got)
 }
 
@@ -1,8 +1,9 @@
 package verifier
 
 import (
+	"context"
+	"fmt"
 	"log"
-	"path"
 	"sort"
 	"time"
 
@@ -21,6 +22,18 @@ type AudioVerifier struct {
 	acClient       *ac.AcoustID
 	mbClient       *mb.MusicBrainz
 	acoustReleases map[ReleaseGroupID]ac.ReleaseGroup
+	progress       *fp.ProgressTracker
+}
+
+// Option configures optional AudioVerifier settings
+type Option func(*AudioVerifier)
+
+// WithProgress reports each fingerprint looked up on AcoustID to tracker. The
+// tracker is usually shared with the Fingerprinter, see fp.WithProgress
+func WithProgress(tracker *fp.ProgressTracker) Option {
+	return func(a *AudioVerifier) {
+		a.progress = tracker
+	}
 }
 
 // AvailableRecording contains the uploaded file path and its associated musicbrainz
@@ -30,37 +43,88 @@ type AvailableRecording struct {
 	FilePath string
 }
 
-func NewAudioVerifier(fp fp.Fingerprinter, acID *ac.AcoustID, mb *mb.MusicBrainz) *AudioVerifier {
-	return &AudioVerifier{
+func NewAudioVerifier(fp fp.Fingerprinter, acID *ac.AcoustID, mb *mb.MusicBrainz, opts ...Option) *AudioVerifier {
+	a := &AudioVerifier{
 		fprinter:       fp,
 		acClient:       acID,
 		mbClient:       mb,
 		acoustReleases: make(map[ReleaseGroupID]ac.ReleaseGroup),
 	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
 }
 
 func (a AudioVerifier) Analyze(inputPath string) (ra *RecAnalysis, err error) {
-	fingerps, err := a.fprinter.CalcFingerprint(inputPath)
+	return a.AnalyzeContext(context.Background(), inputPath)
+}
+
+// AnalyzeContext is like Analyze but stops when ctx is done. Fingerprinting is
+// cancelled when the Fingerprinter implements fp.ContextFingerprinter
+func (a AudioVerifier) AnalyzeContext(ctx context.Context, inputPath string) (ra *RecAnalysis, err error) {
+	var fingerps *fp.BatchResult
+	if ctxFprinter, ok := a.fprinter.(fp.ContextFingerprinter); ok {
+		fingerps, err = ctxFprinter.CalcFingerprintContext(ctx, inputPath)
+	} else {
+		fingerps, err = a.fprinter.CalcFingerprint(inputPath)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	return a.AnalyzeBatch(ctx, fingerps)
+}
+
+// AnalyzeBatch is like AnalyzeContext but analyses fingerprints that were
+// already calculated
+func (a AudioVerifier) AnalyzeBatch(ctx context.Context, fingerps *fp.BatchResult) (*RecAnalysis, error) {
+	// files that couldn't be fingerprinted are reported as unmatched
+	var unmatchedAudioFiles []UnmatchedFile
+	for _, failure := range fingerps.Failures {
+		log.Printf("unable to fingerprint %s: %s", failure.Path, failure.Err)
+		unmatchedAudioFiles = append(unmatchedAudioFiles, UnmatchedFile{
+			FileName: failure.RelPath,
+			Reason:   fmt.Sprintf("audio file couldn't be fingerprinted (%s): %s", failure.Kind, failure.Err),
+		})
+	}
+
 	// query acoustid to match fingerprints with recordings (aka tracks) and get
 	// associated releases (aka albums)
 	var availableRecordings []AvailableRecording
-	var unmatchedAudioFiles []UnmatchedFile
-	var retryOnFail = true
-	for _, fingerp := range fingerps {
-		acLookup, err := a.acClient.LookupFingerprint(fingerp, retryOnFail)
-		if err != nil {
-			return nil, err
+	lookups, err := a.acClient.LookupFingerprintsFunc(ctx, fingerps.Fingerprints, func(batch []ac.BatchLookupResult) {
+		for _, lookup := range batch {
+			if lookup.Err != nil {
+				a.progress.Failed(lookup.Fingerprint.Path(), lookup.Err)
+			} else {
+				a.progress.LookedUp(lookup.Fingerprint.Path())
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, acLookup := range lookups {
+		fingerp := acLookup.Fingerprint
+
+		// files whose lookup failed are reported as unmatched
+		if acLookup.Err != nil {
+			log.Printf("unable to look up %s: %s", fingerp.Path(), acLookup.Err)
+			unmatchedAudioFiles = append(unmatchedAudioFiles, UnmatchedFile{
+				FileName: fingerp.RelPath,
+				Reason:   fmt.Sprintf("audio file fingerprint couldn't be looked up: %s", acLookup.Err),
+			})
+			continue
 		}
 
 		// order by score and get first one
 		if len(acLookup.Results) == 0 {
-			log.Printf("no results found for %s", fingerp.InputFile.Name())
+			log.Printf("no results found for %s", fingerp.RelPath)
 			unmatchedAudioFiles = append(unmatchedAudioFiles, UnmatchedFile{
-				FileName: fingerp.InputFile.Name(),
+				FileName: fingerp.RelPath,
 				Reason:   "audio file fingerprint didn't match any known record",
 			})
 			continue
@@ -70,9 +134,9 @@ func (a AudioVerifier) Analyze(inputPath string) (ra *RecAnalysis, err error) {
 		topAcMatch := acLookup.Results[0]
 
 		if len(topAcMatch.Recordings) == 0 {
-			log.Printf("no recordings found for %s", fingerp.InputFile.Name())
+			log.Printf("no recordings found for %s", fingerp.RelPath)
 			unmatchedAudioFiles = append(unmatchedAudioFiles, UnmatchedFile{
-				FileName: fingerp.InputFile.Name(),
+				FileName: fingerp.RelPath,
 				Reason:   "audio file fingerprint didn't match any known release",
 			})
 		}
@@ -80,7 +144,7 @@ func (a AudioVerifier) Analyze(inputPath string) (ra *RecAnalysis, err error) {
 		for _, recording := range topAcMatch.Recordings {
 			log.Printf("[mb recording ID] %s \n", recording.MBRecordingID)
 
-			availableRecordings = append(availableRecordings, AvailableRecording{recording.MBRecordingID, path.Join(inputPath, fingerp.InputFile.Name())})
+			availableRecordings = append(availableRecordings, AvailableRecording{recording.MBRecordingID, fingerp.Path()})
 
 			for _, releaseGroup := range recording.MBReleaseGroups {
 				releaseGroupInfo, ok := a.acoustReleases[ReleaseGroupID(releaseGroup.ID)]
@@ -105,6 +169,10 @@ func (a AudioVerifier) Analyze(inputPath string) (ra *RecAnalysis, err error) {
 		}
 
 		for _, release := range releaseGroupInfo.Releases {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
 			log.Printf("mb lookup release: %s \n", release.ID)
 
 			releaseInfo, err := a.mbClient.GetReleaseInfo(release.ID)
@@ -149,14 +217,16 @@ func (a AudioVerifier) Analyze(inputPath string) (ra *RecAnalysis, err error) {
 					}
 				}
 			}
-
-			time.Sleep(mb.MusicBrainzReqDelay)
 		}
 
 		analysis.MatchedReleases = append(analysis.MatchedReleases, releaseData)
 	}
 	analysis.UnmatchedFiles = unmatchedAudioFiles
 
+	if versioned, ok := a.fprinter.(interface{ Version() fp.FPcalcVersion }); ok {
+		analysis.FPcalcVersion = versioned.Version().String()
+	}
+
 	return &analysis, nil
 }
 
@@ -180,10 +250,12 @@ func addMissingReleasesIDToGroup(new *ac.ReleaseGroup, existing *ac.ReleaseGroup
 	return existing
 }
 
-// RecAnalysis is the result of performing audio analysis on a group of files
+// RecAnalysis is the result of performing audio analysis on a group of files.
+// FPcalcVersion is set when the fingerprints were calculated with fpcalc
 type RecAnalysis struct {
 	MatchedReleases []ReleaseMeta
 	UnmatchedFiles  []UnmatchedFile
+	FPcalcVersion   string
 }
 
 // ReleaseMeta contains metadata that describes a single release
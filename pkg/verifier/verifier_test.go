@@ -0,0 +1,266 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+
+	ac "github.com/ocramh/fingerprinter/pkg/acoustid"
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+	mb "github.com/ocramh/fingerprinter/pkg/musicbrainz"
+	mb_types "github.com/ocramh/fingerprinter/pkg/musicbrainz/types"
+)
+
+const testReleaseID = "the-release"
+
+// testFingerprints returns n fingerprints with the value fp-<i>. Some of them
+// have no Source and one comes from an archive
+func testFingerprints(n int) []*fp.Fingerprint {
+	fingerprints := make([]*fp.Fingerprint, n)
+	for i := range fingerprints {
+		f := &fp.Fingerprint{
+			Duration: 100,
+			Value:    fmt.Sprintf("fp-%d", i),
+			RelPath:  fmt.Sprintf("track-%d.mp3", i),
+		}
+
+		switch {
+		case i%5 == 0:
+		case i == 7:
+			f.Source = &fp.Source{Path: "/music/album.zip", Entry: f.RelPath}
+		default:
+			f.Source = &fp.Source{Path: "/music/" + f.RelPath}
+		}
+
+		fingerprints[i] = f
+	}
+
+	return fingerprints
+}
+
+// matches reports whether the fingerprint fp-<i> is known to the fake
+// AcoustID server
+func matches(i int) bool {
+	return i%3 != 0
+}
+
+// newAcoustIDServer returns a fake AcoustID lookup API matching each known
+// fingerprint fp-<i> with the recording rec-<i>, and the size of the batches
+// it received. The requests numbered in failing are rejected
+func newAcoustIDServer(t *testing.T, failing ...int) (*httptest.Server, func() []int) {
+	var mu sync.Mutex
+	var batchSizes []int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+
+		mu.Lock()
+		call := len(batchSizes) + 1
+		mu.Unlock()
+		for _, failed := range failing {
+			if call == failed {
+				mu.Lock()
+				batchSizes = append(batchSizes, 0)
+				mu.Unlock()
+
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"status": "error", "error": {"code": 3, "message": "invalid fingerprint"}}`))
+				return
+			}
+		}
+
+		type fingerprintResp struct {
+			Index   string              `json:"index"`
+			Results []ac.ACLookupResult `json:"results"`
+		}
+		resp := struct {
+			Status       string            `json:"status"`
+			Fingerprints []fingerprintResp `json:"fingerprints"`
+		}{Status: "ok"}
+
+		n := 0
+		for ; r.PostForm.Get("fingerprint."+strconv.Itoa(n)) != ""; n++ {
+			i, err := strconv.Atoi(strings.TrimPrefix(r.PostForm.Get("fingerprint."+strconv.Itoa(n)), "fp-"))
+			assert.NoError(t, err)
+
+			if !matches(i) {
+				continue
+			}
+			resp.Fingerprints = append(resp.Fingerprints, fingerprintResp{
+				Index: strconv.Itoa(n),
+				Results: []ac.ACLookupResult{{
+					ID:    fmt.Sprintf("ac-%d", i),
+					Score: 1,
+					Recordings: []ac.Recording{{
+						MBRecordingID: fmt.Sprintf("rec-%d", i),
+						MBReleaseGroups: []ac.ReleaseGroup{{
+							ID:       "the-release-group",
+							Title:    "The Album",
+							Releases: []ac.Release{{ID: testReleaseID}},
+						}},
+					}},
+				}},
+			})
+		}
+
+		mu.Lock()
+		batchSizes = append(batchSizes, n)
+		mu.Unlock()
+
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), batchSizes...)
+	}
+}
+
+// mockRelease serves the release holding the recordings rec-<0..n> from the
+// MusicBrainz API
+func mockRelease(t *testing.T, n int) {
+	var tracks []mb_types.Track
+	for i := 0; i < n; i++ {
+		tracks = append(tracks, mb_types.Track{
+			ID:        fmt.Sprintf("track-%d", i),
+			Position:  i + 1,
+			Recording: mb_types.Recording{ID: fmt.Sprintf("rec-%d", i), ISRCs: []string{fmt.Sprintf("ISRC%d", i)}},
+		})
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"id":    testReleaseID,
+		"title": "The Album",
+		"date":  "2014-01-01",
+		"media": []mb_types.Media{{Format: "CD", Tracks: tracks}},
+	})
+	assert.NoError(t, err)
+
+	params := url.Values{}
+	params.Add("fmt", "json")
+	params.Add("inc", strings.Join(mb.ReleaseInfoQueryVals, "+"))
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s?%s", mb.MusicBrainzReleaseURL, testReleaseID, params.Encode()),
+		httpmock.NewBytesResponder(http.StatusOK, data),
+	)
+}
+
+func TestAnalyzeBatch(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	// more fingerprints than fit in a lookup request
+	n := ac.LookupBatchSize + 5
+	fingerprints := testFingerprints(n)
+	mockRelease(t, n)
+
+	server, batchSizes := newAcoustIDServer(t)
+	acClient := ac.NewAcoustID("secret-key",
+		ac.WithEndpoint(server.URL),
+		ac.WithHTTPClient(server.Client()),
+		ac.WithRateLimit(100, time.Second),
+	)
+	mbClient := mb.NewMusicBrainz("fingerprinter", "test", "test@example.com")
+
+	analysis, err := NewAudioVerifier(nil, acClient, mbClient).AnalyzeBatch(context.Background(), &fp.BatchResult{Fingerprints: fingerprints})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{ac.LookupBatchSize, 5}, batchSizes())
+
+	// each matched recording is mapped back to the file it was found for
+	assert.Len(t, analysis.MatchedReleases, 1)
+	gotPaths := make(map[string]string)
+	for _, track := range analysis.MatchedReleases[0].AvailableTracks {
+		gotPaths[track.Track.Recording.ID] = track.Path
+	}
+
+	wantPaths := make(map[string]string)
+	var wantUnmatched []UnmatchedFile
+	for i, f := range fingerprints {
+		if matches(i) {
+			wantPaths[fmt.Sprintf("rec-%d", i)] = f.Path()
+			continue
+		}
+		wantUnmatched = append(wantUnmatched, UnmatchedFile{
+			FileName: f.RelPath,
+			Reason:   "audio file fingerprint didn't match any known record",
+		})
+	}
+	assert.Equal(t, wantPaths, gotPaths)
+	assert.Equal(t, "/music/album.zip!/track-7.mp3", gotPaths["rec-7"])
+	assert.Equal(t, "track-10.mp3", gotPaths["rec-10"])
+	assert.Equal(t, wantUnmatched, analysis.UnmatchedFiles)
+}
+
+func TestAnalyzeBatchLookupFailure(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	n := ac.LookupBatchSize + 5
+	fingerprints := testFingerprints(n)
+	mockRelease(t, n)
+
+	// the second lookup request fails
+	server, batchSizes := newAcoustIDServer(t, 2)
+	acClient := ac.NewAcoustID("secret-key",
+		ac.WithEndpoint(server.URL),
+		ac.WithHTTPClient(server.Client()),
+		ac.WithRateLimit(100, time.Second),
+	)
+	mbClient := mb.NewMusicBrainz("fingerprinter", "test", "test@example.com")
+
+	// the lookups are reported as each request completes
+	var events []fp.ProgressEvent
+	var requests []int
+	progress := fp.NewProgressTracker(func(e fp.ProgressEvent) {
+		events = append(events, e)
+		requests = append(requests, len(batchSizes()))
+	})
+
+	verifier := NewAudioVerifier(nil, acClient, mbClient, WithProgress(progress))
+	analysis, err := verifier.AnalyzeBatch(context.Background(), &fp.BatchResult{Fingerprints: fingerprints})
+	assert.NoError(t, err)
+
+	assert.Len(t, events, n)
+	for i, e := range events {
+		if i < ac.LookupBatchSize {
+			assert.Equal(t, fp.EventLookedUp, e.Kind)
+			assert.Equal(t, 1, requests[i])
+			continue
+		}
+		assert.Equal(t, fp.EventFailed, e.Kind)
+		assert.Equal(t, fingerprints[i].Path(), e.Path)
+	}
+
+	// the matches of the first batch are kept and the files of the failed one
+	// are unmatched
+	assert.Len(t, analysis.MatchedReleases, 1)
+	for _, track := range analysis.MatchedReleases[0].AvailableTracks {
+		i, err := strconv.Atoi(strings.TrimPrefix(track.Track.Recording.ID, "rec-"))
+		assert.NoError(t, err)
+		assert.True(t, i < ac.LookupBatchSize, "%s matched", track.Track.Recording.ID)
+	}
+
+	var failed []string
+	for _, unmatched := range analysis.UnmatchedFiles {
+		if strings.Contains(unmatched.Reason, "invalid fingerprint") {
+			failed = append(failed, unmatched.FileName)
+		}
+	}
+	var want []string
+	for _, f := range fingerprints[ac.LookupBatchSize:] {
+		want = append(want, f.RelPath)
+	}
+	assert.Equal(t, want, failed)
+}
@@ -0,0 +1,286 @@
+// Package watch fingerprints the audio files added to a directory tree while it
+// is being monitored
+package watch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+)
+
+const (
+	// DefaultDebounce is how long a file must stay unchanged before it is
+	// fingerprinted
+	DefaultDebounce = 2 * time.Second
+)
+
+// Result is the outcome of fingerprinting a file found by a Watcher. Either
+// Fingerprint or Failure is set. Archives produce a Result for each entry
+type Result struct {
+	Path        string          `json:"path"`
+	Fingerprint *fp.Fingerprint `json:"fingerprint,omitempty"`
+	Failure     *fp.FileError   `json:"failure,omitempty"`
+}
+
+// Handler is called with the Result of each fingerprinted file
+type Handler func(ctx context.Context, res Result)
+
+// Watcher monitors a directory tree and fingerprints the files created, moved or
+// written in it once they stop changing. Files the Fingerprinter doesn't
+// support are ignored
+type Watcher struct {
+	fprinter    fp.ContextFingerprinter
+	debounce    time.Duration
+	concurrency int
+
+	// ready is called once the directory tree is being watched
+	ready func()
+}
+
+// Option configures optional Watcher settings
+type Option func(*Watcher)
+
+// WithDebounce sets how long a file must stay unchanged before it is
+// fingerprinted, so that partially written files are skipped. It defaults to
+// DefaultDebounce
+func WithDebounce(d time.Duration) Option {
+	return func(w *Watcher) {
+		w.debounce = d
+	}
+}
+
+// WithConcurrency sets the maximum number of files fingerprinted in parallel. It
+// defaults to the number of CPUs
+func WithConcurrency(n int) Option {
+	return func(w *Watcher) {
+		w.concurrency = n
+	}
+}
+
+func NewWatcher(fprinter fp.ContextFingerprinter, opts ...Option) *Watcher {
+	w := &Watcher{
+		fprinter:    fprinter,
+		debounce:    DefaultDebounce,
+		concurrency: runtime.NumCPU(),
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// pendingFile is a file waiting to stay unchanged for the debounce duration.
+// gen identifies its latest change, so that stale timers are ignored
+type pendingFile struct {
+	timer *time.Timer
+	gen   int
+}
+
+type settledFile struct {
+	path string
+	gen  int
+}
+
+// Run watches the directory tree rooted at root until ctx is done, calling
+// handle with the Result of each new file. The files already in the tree are
+// not fingerprinted. handle is never called concurrently. Run returns the ctx
+// error, or the error that stopped the file system notifications
+func (w *Watcher) Run(ctx context.Context, root string, handle Handler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsw.Close()
+
+	if _, err := addTree(fsw, root); err != nil {
+		return err
+	}
+	if w.ready != nil {
+		w.ready()
+	}
+
+	jobs := make(chan string)
+	settled := make(chan settledFile)
+	pending := make(map[string]*pendingFile)
+	var gen int
+
+	var handleMu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	workers := w.concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for fPath := range jobs {
+				for _, res := range w.fingerprint(ctx, fPath) {
+					handleMu.Lock()
+					handle(ctx, res)
+					handleMu.Unlock()
+				}
+			}
+		}()
+	}
+	defer close(jobs)
+
+	// schedule (re)starts the debounce timer of the file at fPath
+	schedule := func(fPath string) {
+		p, ok := pending[fPath]
+		if ok {
+			p.timer.Stop()
+		} else {
+			p = &pendingFile{}
+			pending[fPath] = p
+		}
+		gen++
+		p.gen = gen
+
+		s := settledFile{path: fPath, gen: gen}
+		p.timer = time.AfterFunc(w.debounce, func() {
+			select {
+			case settled <- s:
+			case <-ctx.Done():
+			}
+		})
+	}
+
+	// settled files wait in queue for a worker, so that file system events are
+	// still read while all the workers are busy
+	var queue []string
+	for {
+		var next chan string
+		var head string
+		if len(queue) > 0 {
+			next = jobs
+			head = queue[0]
+		}
+
+		select {
+		case next <- head:
+			queue = queue[1:]
+
+		case <-ctx.Done():
+			for _, p := range pending {
+				p.timer.Stop()
+			}
+			return ctx.Err()
+
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+
+		case ev, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+
+			switch {
+			case ev.Op&fsnotify.Create != 0:
+				info, err := os.Stat(ev.Name)
+				if err != nil {
+					// removed before being noticed
+					continue
+				}
+
+				if !info.IsDir() {
+					schedule(ev.Name)
+					continue
+				}
+
+				// directories moved in the tree come with their files. The
+				// directories removed while being added are skipped
+				files, _ := addTree(fsw, ev.Name)
+				for _, f := range files {
+					schedule(f)
+				}
+
+			case ev.Op&fsnotify.Write != 0:
+				schedule(ev.Name)
+
+			case ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				if p, ok := pending[ev.Name]; ok {
+					p.timer.Stop()
+					delete(pending, ev.Name)
+				}
+			}
+
+		case s := <-settled:
+			if p, ok := pending[s.path]; !ok || p.gen != s.gen {
+				continue
+			}
+			delete(pending, s.path)
+			queue = append(queue, s.path)
+		}
+	}
+}
+
+// fingerprint returns the Results of fingerprinting the file at fPath. No
+// Results are returned for unsupported or removed files
+func (w *Watcher) fingerprint(ctx context.Context, fPath string) []Result {
+	batch, err := w.fprinter.CalcFingerprintContext(ctx, fPath)
+	if err != nil {
+		var fileErr *fp.FileError
+		switch {
+		case errors.As(err, &fileErr):
+			return []Result{{Path: fPath, Failure: fileErr}}
+		case errors.Is(err, fp.ErrInvalidFormat), errors.Is(err, fp.ErrInvalidPath), ctx.Err() != nil:
+			return nil
+		}
+
+		// archives are partially fingerprinted when a limit is exceeded
+		if batch == nil {
+			return []Result{{Path: fPath, Failure: &fp.FileError{Path: fPath, Kind: fp.FailureUnknown, Err: err}}}
+		}
+		batch.Failures = append(batch.Failures, &fp.FileError{Path: fPath, Kind: fp.FailureUnknown, Err: err})
+	}
+
+	var results []Result
+	for _, fing := range batch.Fingerprints {
+		results = append(results, Result{Path: fPath, Fingerprint: fing})
+	}
+	for _, failure := range batch.Failures {
+		results = append(results, Result{Path: fPath, Failure: failure})
+	}
+
+	return results
+}
+
+// addTree watches the directory at root and its subdirectories, returning the
+// files found in them
+func addTree(fsw *fsnotify.Watcher, root string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(root, func(fPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			files = append(files, fPath)
+			return nil
+		}
+
+		return fsw.Add(fPath)
+	})
+
+	return files, err
+}
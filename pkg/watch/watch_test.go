@@ -0,0 +1,166 @@
+package watch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	fp "github.com/ocramh/fingerprinter/pkg/fingerprint"
+)
+
+const testDebounce = 200 * time.Millisecond
+
+// fakeFingerprinter uses the content of the .mp3 files as their fingerprint
+type fakeFingerprinter struct{}
+
+func (fakeFingerprinter) CalcFingerprint(fPath string) (*fp.BatchResult, error) {
+	return fakeFingerprinter{}.CalcFingerprintContext(context.Background(), fPath)
+}
+
+func (fakeFingerprinter) CalcFingerprintContext(ctx context.Context, fPath string) (*fp.BatchResult, error) {
+	if filepath.Ext(fPath) != ".mp3" {
+		return nil, fp.ErrInvalidFormat
+	}
+
+	content, err := ioutil.ReadFile(fPath)
+	if err != nil {
+		return nil, fp.ErrInvalidPath
+	}
+
+	if len(content) == 0 {
+		return nil, &fp.FileError{Path: fPath, Kind: fp.FailureDecode, Err: fp.ErrEmptyFingerprint}
+	}
+
+	return &fp.BatchResult{
+		Fingerprints: []*fp.Fingerprint{{Value: string(content), RelPath: filepath.Base(fPath)}},
+	}, nil
+}
+
+// results collects the Results passed to a Handler
+type results struct {
+	mu  sync.Mutex
+	got []Result
+}
+
+func (r *results) handle(ctx context.Context, res Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.got = append(r.got, res)
+}
+
+func (r *results) get() []Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Result(nil), r.got...)
+}
+
+// waitForResults waits for n Results to be collected
+func waitForResults(t *testing.T, res *results, n int) {
+	deadline := time.Now().Add(5 * testDebounce)
+	for len(res.get()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d results, want %d", len(res.get()), n)
+		}
+		time.Sleep(testDebounce / 10)
+	}
+}
+
+// startWatcher runs a Watcher on a new temporary directory until the test ends
+func startWatcher(t *testing.T) (string, *results) {
+	dir, err := ioutil.TempDir("", "fingerprinter-watch")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res := &results{}
+	ready := make(chan struct{})
+	done := make(chan error, 1)
+
+	w := NewWatcher(fakeFingerprinter{}, WithDebounce(testDebounce))
+	w.ready = func() { close(ready) }
+	go func() {
+		done <- w.Run(ctx, dir, res.handle)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.Equal(t, context.Canceled, <-done)
+	})
+
+	select {
+	case <-ready:
+	case err := <-done:
+		done <- err
+		t.Fatalf("watcher stopped: %s", err)
+	}
+
+	return dir, res
+}
+
+func TestWatchDebouncesWrites(t *testing.T) {
+	dir, res := startWatcher(t)
+
+	f, err := os.Create(filepath.Join(dir, "track.mp3"))
+	assert.NoError(t, err)
+	for _, part := range []string{"first ", "second ", "third"} {
+		f.WriteString(part)
+		time.Sleep(testDebounce / 4)
+	}
+	f.Close()
+
+	waitForResults(t, res, 1)
+
+	got := res.get()[0]
+	assert.Equal(t, filepath.Join(dir, "track.mp3"), got.Path)
+	assert.Equal(t, "first second third", got.Fingerprint.Value)
+	assert.Nil(t, got.Failure)
+
+	// no further results for the same file
+	time.Sleep(2 * testDebounce)
+	assert.Len(t, res.get(), 1)
+}
+
+func TestWatchSkipsUnsupportedFiles(t *testing.T) {
+	dir, res := startWatcher(t)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("text"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "empty.mp3"), nil, 0644))
+
+	waitForResults(t, res, 1)
+
+	got := res.get()[0]
+	assert.Nil(t, got.Fingerprint)
+	assert.Equal(t, fp.FailureDecode, got.Failure.Kind)
+
+	time.Sleep(2 * testDebounce)
+	assert.Len(t, res.get(), 1)
+}
+
+func TestWatchSubdirectories(t *testing.T) {
+	dir, res := startWatcher(t)
+
+	// a directory moved into the tree with its files
+	staging, err := ioutil.TempDir("", "fingerprinter-staging")
+	assert.NoError(t, err)
+	defer os.RemoveAll(staging)
+	assert.NoError(t, os.MkdirAll(filepath.Join(staging, "album", "cd1"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(staging, "album", "cd1", "01.mp3"), []byte("one"), 0644))
+	assert.NoError(t, os.Rename(filepath.Join(staging, "album"), filepath.Join(dir, "album")))
+
+	waitForResults(t, res, 1)
+
+	// files added to the new subdirectories
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "album", "cd1", "02.mp3"), []byte("two"), 0644))
+	waitForResults(t, res, 2)
+
+	var values []string
+	for _, r := range res.get() {
+		values = append(values, r.Fingerprint.Value)
+	}
+	assert.ElementsMatch(t, []string{"one", "two"}, values)
+}